@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -602,7 +603,7 @@ func (v *View) ParagraphPrevious(usePlugin bool) bool {
 	}
 	var line int
 	for line = v.Cursor.Y; line > 0; line-- {
-		if len(v.Buf.lines[line].data) == 0 && line != v.Cursor.Y {
+		if len(v.Buf.LineBytes(line)) == 0 && line != v.Cursor.Y {
 			v.Cursor.X = 0
 			v.Cursor.Y = line
 			break
@@ -627,15 +628,15 @@ func (v *View) ParagraphNext(usePlugin bool) bool {
 	}
 
 	var line int
-	for line = v.Cursor.Y; line < len(v.Buf.lines); line++ {
-		if len(v.Buf.lines[line].data) == 0 && line != v.Cursor.Y {
+	for line = v.Cursor.Y; line < v.Buf.LinesNum(); line++ {
+		if len(v.Buf.LineBytes(line)) == 0 && line != v.Cursor.Y {
 			v.Cursor.X = 0
 			v.Cursor.Y = line
 			break
 		}
 	}
 	// If no empty line found. move cursor to end of buffer
-	if line == len(v.Buf.lines) {
+	if line == v.Buf.LinesNum() {
 		v.Cursor.Loc = v.Buf.End()
 	}
 	v.savedLoc = v.Cursor.Loc
@@ -670,7 +671,7 @@ func (v *View) Retab(usePlugin bool) bool {
 		}
 
 		l = strings.TrimLeft(l, " \t")
-		v.Buf.lines[i].data = []byte(ws + l)
+		v.Buf.setLine(i, []byte(ws+l))
 		dirty = true
 	}
 
@@ -1165,6 +1166,9 @@ func (v *View) saveToFile(filename string) {
 		v.Buf.Fname = filepath.Base(filename)
 		messenger.Message(Language.Translate("Saved") + " " + filename)
 		git.GitSetStatus()
+		if v.onSave != nil {
+			v.onSave(v)
+		}
 	}
 }
 
@@ -1262,8 +1266,8 @@ func (v *View) Undo(usePlugin bool) bool {
 		v.Center(false)
 	}
 
-	// If current undo stack len == Last Saved Stack Len, buffer is not modified
-	if v.Buf.UndoStack.Len() == v.Buf.UndoStackRef {
+	// If the current undo state is the saved one, buffer is not modified
+	if v.Buf.UndoTree.Saved() {
 		v.Buf.IsModified = false
 	}
 
@@ -1288,8 +1292,8 @@ func (v *View) Redo(usePlugin bool) bool {
 		v.Center(false)
 	}
 
-	// If current undo stack len == Last Saved Stack Len, buffer is not modified
-	if v.Buf.UndoStack.Len() == v.Buf.UndoStackRef {
+	// If the current undo state is the saved one, buffer is not modified
+	if v.Buf.UndoTree.Saved() {
 		v.Buf.IsModified = false
 	}
 
@@ -1514,7 +1518,7 @@ func (v *View) MoveLinesDown(usePlugin bool) bool {
 	}
 
 	if v.Cursor.HasSelection() {
-		if v.Cursor.CurSelection[1].Y >= len(v.Buf.lines) {
+		if v.Cursor.CurSelection[1].Y >= v.Buf.LinesNum() {
 			return true
 		}
 		start := v.Cursor.CurSelection[0].Y
@@ -1528,7 +1532,7 @@ func (v *View) MoveLinesDown(usePlugin bool) bool {
 			end,
 		)
 	} else {
-		if v.Cursor.Loc.Y >= len(v.Buf.lines)-1 {
+		if v.Cursor.Loc.Y >= v.Buf.LinesNum()-1 {
 			return true
 		}
 		v.Buf.MoveLinesDown(
@@ -1987,6 +1991,10 @@ func (v *View) Escape(usePlugin bool) bool {
 			messenger.Reset()
 			return true
 		}
+		// stop a gemini answer still streaming
+		if GeminiCancel() {
+			return true
+		}
 	}
 
 	return false
@@ -2044,9 +2052,13 @@ func (v *View) Quit(usePlugin bool) bool {
 			return false
 		}
 
+		if globalSettings["autosave-quit"].(bool) {
+			v.autosave()
+		}
 		// Make sure not to quit if there are unsaved changes
 		if v.CanClose() {
 			LastView = -1
+			v.resetHooks()
 			if len(tabs[curTab].Views) > 1 {
 				pos := v.splitNode.GetViewNumPosition(v.Num)
 				v.splitNode.Delete()
@@ -2091,6 +2103,9 @@ func (v *View) QuitAll(usePlugin bool) bool {
 			return false
 		}
 
+		if globalSettings["autosave-quit"].(bool) {
+			AutosaveAll()
+		}
 		closeAll := true
 		for _, tab := range tabs {
 			for _, v := range tab.Views {
@@ -2113,6 +2128,13 @@ func (v *View) QuitAll(usePlugin bool) bool {
 			// 	}
 			// }
 
+			for _, tab := range tabs {
+				for _, v := range tab.Views {
+					if v.onClose != nil {
+						v.onClose(v)
+					}
+				}
+			}
 			if usePlugin {
 				PostActionCall("QuitAll", v)
 			}
@@ -2854,7 +2876,9 @@ func (v *View) FindFunctionDeclaration(usePlugin bool) bool {
 	messenger.Message("")
 	ok, where, word, line := v.SearchFunction(false)
 	if !ok {
-		messenger.Warning("function not found : ", word)
+		if word != "" {
+			messenger.Warning("function not found : ", word)
+		}
 		return true
 	}
 	v.VSplit(v.Buf)
@@ -2879,7 +2903,9 @@ func (v *View) HintFunction(usePlugin bool) bool {
 	messenger.Message("")
 	ok, data, word, _ := v.SearchFunction(true)
 	if !ok {
-		messenger.Warning("function not found : ", word)
+		if word != "" {
+			messenger.Warning("function not found : ", word)
+		}
 		return true
 	}
 	v.OpenHelperView("h", v.Buf.Settings["filetype"].(string), data)
@@ -2887,7 +2913,8 @@ func (v *View) HintFunction(usePlugin bool) bool {
 }
 
 // SearchFunction :
-// Search for word under cursor in the current buffer or the file system
+// Search for word under cursor in the current buffer and the project symbol index
+// If there is more than one declaration the user chooses one, an empty word is returned if canceled
 // If searching for hint, return previous comments, and first line of function
 func (v *View) SearchFunction(hint bool) (bool, string, string, int) {
 	loc := v.Cursor.Loc
@@ -2898,44 +2925,100 @@ func (v *View) SearchFunction(hint bool) (bool, string, string, int) {
 	if word == "" {
 		return false, "", word, 0
 	}
-	exp := `^\s*(?:local )?(?:func(?:tion)?|def(?:n|un|ine)?|fn|sub|let|\w+\s+(?:\(.*?\)))\s+` + word + `\s*(?:(?:\(.*?\))|\s*\W)|` + word + `\s*:?=\s*(?:func(?:tion|fn|sub)[\s\{\(])`
+	exp := defaultFindFuncRegex
 	if v.Buf.Settings["findfuncregex"].(string) != "" {
-		exp = strings.ReplaceAll(v.Buf.Settings["findfuncregex"].(string), "%word%", word)
+		exp = v.Buf.Settings["findfuncregex"].(string)
 	}
-	r := regexp.MustCompile(exp)
-	//search function definition in current buffer
-	line, ok := FindLineWith(r, v, v.Cursor.Loc, v.Buf.End(), false)
-	if ok {
-		if !hint {
-			return true, "b", word, line
-		}
-		comment := regexp.MustCompile(`^\s*(?:#|//|(?:<!)?--|/\*)`)
-		data := ""
-		for l := line - 5; l < line+4; l++ {
-			if l < 0 {
-				continue
-			} else if l > v.Buf.End().Y {
-				break
-			}
-			d := v.Buf.Line(l)
-			if l < line {
-				if comment.MatchString(d) {
-					data = data + d + "\n"
-				}
-				continue
+	r, err := regexp.Compile(strings.ReplaceAll(exp, "%word%", regexp.QuoteMeta(word)))
+	if err != nil {
+		messenger.AddLog("findfuncregex: ", err.Error())
+		return false, "", word, 0
+	}
+	// the current buffer may have unsaved changes, it is searched instead of its indexed declarations
+	var defs []symbolLoc
+	for i := range v.Buf.LinesNum() {
+		if l := v.Buf.Line(i); r.MatchString(l) {
+			defs = append(defs, symbolLoc{v.Buf.AbsPath, i, l})
+		}
+	}
+	index := ProjectSymbols(v.Buf)
+	if index != nil {
+		for _, d := range index.lookup(word) {
+			if d.path != v.Buf.AbsPath {
+				defs = append(defs, d)
 			}
-			data = data + d + "\n"
 		}
-		return true, data, word, line
 	}
-	// search in files in the current directory
-	messenger.Message("Searching in file system, wait ....")
-	data, line, ok := FindFileWith(r, filepath.Dir(v.Buf.Path), v.Buf.FileType(), path.Ext(v.Buf.Fname), 2, hint)
-	messenger.Message("")
-	if ok {
-		return true, data, word, line
+	if len(defs) == 0 && (index == nil || !index.isReady()) {
+		// search in files in the current directory
+		messenger.Message("Searching in file system, wait ....")
+		data, line, ok := FindFileWith(r, filepath.Dir(v.Buf.Path), v.Buf.FileType(), path.Ext(v.Buf.Fname), 2, hint)
+		messenger.Message("")
+		if ok {
+			return true, data, word, line
+		}
+	}
+	if len(defs) == 0 {
+		return false, "", word, 0
+	}
+	d := defs[0]
+	if len(defs) > 1 {
+		n := v.chooseDeclaration(word, defs)
+		if n < 0 {
+			return false, "", "", 0
+		}
+		d = defs[n]
+	}
+	if d.path == v.Buf.AbsPath {
+		if !hint {
+			return true, "b", word, d.line
+		}
+		return true, functionHint(d.line, v.Buf.LinesNum(), v.Buf.Line), word, d.line
+	}
+	if !hint {
+		return true, d.path, word, d.line
+	}
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return false, "", word, 0
+	}
+	lines := strings.Split(string(data), "\n")
+	return true, functionHint(d.line, len(lines), func(i int) string { return lines[i] }), word, d.line
+}
+
+// chooseDeclaration lists the declarations in a helper view and asks for the one to use
+// Returns -1 if canceled
+func (v *View) chooseDeclaration(word string, defs []symbolLoc) int {
+	total := len(defs)
+	if len(defs) > 9 {
+		defs = defs[:9]
+	}
+	root := GetProjectDir(workingDir, filepath.Dir(v.Buf.AbsPath))
+	data := ""
+	responses := make([]rune, 0, len(defs))
+	for i, d := range defs {
+		name, err := filepath.Rel(root, d.path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			name = d.path
+		}
+		data += fmt.Sprintf("%d  %s:%d\n     %s\n", i+1, name, d.line+1, strings.TrimSpace(d.text))
+		responses = append(responses, rune('1'+i))
+	}
+	v.OpenHelperView("h", v.Buf.FileType(), data, 0.4)
+	RedrawAll(false)
+	msg := fmt.Sprintf("%s is declared %d times, choose one (1-%d) ", word, total, len(defs))
+	if total > len(defs) {
+		msg = fmt.Sprintf("%s is declared %d times, the first %d are listed, choose one (1-%d) ", word, total, len(defs), len(defs))
+	}
+	choice, canceled := messenger.LetterPrompt(false, msg, responses...)
+	v.CloseHelperView()
+	if CurView().Type.Kind == 0 {
+		navigationMode = false
+	}
+	if canceled {
+		return -1
 	}
-	return false, "", word, 0
+	return int(choice - '1')
 }
 
 // ComboKeyActive check Ctrl-k pressed
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// aiProvider is the backend used by the gemini: command group
+// ask waits for the complete answer, stream delivers the answer to a conversation in chunks as they arrive
+// cancel aborts the request in progress (if any)
+type aiProvider interface {
+	ask(question string) (string, error)
+	stream(messages []aiMessage, chunk func(string)) error
+	cancel()
+}
+
+// aiMessage is one turn of a conversation, Role is "user" or "model"
+type aiMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// aiConfig holds the global settings that configure a provider
+type aiConfig struct {
+	provider       string
+	endpoint       string
+	model          string
+	key            string
+	thinkingBudget int32
+}
+
+// aiConfigFromSettings reads the ai-* global settings
+func aiConfigFromSettings() aiConfig {
+	c := aiConfig{
+		provider:       globalSettings["ai-provider"].(string),
+		endpoint:       globalSettings["ai-endpoint"].(string),
+		model:          globalSettings["ai-model"].(string),
+		thinkingBudget: int32(globalSettings["ai-thinkingbudget"].(float64)),
+	}
+	if env := globalSettings["ai-keyenv"].(string); env != "" {
+		c.key = os.Getenv(env)
+	}
+	return c
+}
+
+// newAIProvider create the provider selected in settings
+func newAIProvider(c aiConfig) (aiProvider, error) {
+	switch c.provider {
+	case "", "gemini":
+		return newGeminiProvider(c)
+	case "openai":
+		return newOpenAIProvider(c)
+	}
+	return nil, errors.New("unknown ai provider: " + c.provider)
+}
+
+// aiName is the name of the ai service shown to the user
+func aiName() string {
+	if globalSettings["ai-provider"].(string) == "openai" {
+		return "OpenAI"
+	}
+	return "Gemini"
+}
+
+// aiRequest keeps the cancel function of the request in progress
+type aiRequest struct {
+	mu       sync.Mutex
+	cancelFn context.CancelFunc
+}
+
+func (r *aiRequest) start() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancelFn = cancel
+	r.mu.Unlock()
+	return ctx
+}
+
+func (r *aiRequest) cancel() {
+	r.mu.Lock()
+	if r.cancelFn != nil {
+		r.cancelFn()
+		r.cancelFn = nil
+	}
+	r.mu.Unlock()
+}
+
+// : Gemini
+
+type geminiProvider struct {
+	aiRequest
+	client *genai.Client
+	model  string
+	budget int32
+}
+
+func newGeminiProvider(c aiConfig) (*geminiProvider, error) {
+	cc := &genai.ClientConfig{APIKey: c.key}
+	if c.endpoint != "" {
+		cc.HTTPOptions.BaseURL = c.endpoint
+	}
+	client, err := genai.NewClient(context.Background(), cc)
+	if err != nil {
+		return nil, err
+	}
+	model := c.model
+	if model == "" {
+		model = "gemini-3-flash-preview"
+	}
+	return &geminiProvider{client: client, model: model, budget: c.thinkingBudget}, nil
+}
+
+func (g *geminiProvider) config() *genai.GenerateContentConfig {
+	budget := g.budget
+	return &genai.GenerateContentConfig{
+		ThinkingConfig: &genai.ThinkingConfig{
+			ThinkingBudget: &budget,
+		},
+	}
+}
+
+func (g *geminiProvider) ask(question string) (string, error) {
+	ctx := g.start()
+	defer g.cancel()
+	result, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(question), g.config())
+	if err != nil {
+		return "", err
+	}
+	return result.Text(), nil
+}
+
+func (g *geminiProvider) stream(messages []aiMessage, chunk func(string)) error {
+	ctx := g.start()
+	defer g.cancel()
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, m := range messages {
+		contents = append(contents, genai.NewContentFromText(m.Content, genai.Role(m.Role)))
+	}
+	for result, err := range g.client.Models.GenerateContentStream(ctx, g.model, contents, g.config()) {
+		if err != nil {
+			return err
+		}
+		chunk(result.Text())
+	}
+	return nil
+}
+
+// : OpenAI compatible
+
+type openAIProvider struct {
+	aiRequest
+	client   *http.Client
+	endpoint string
+	model    string
+	key      string
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newOpenAIProvider(c aiConfig) (*openAIProvider, error) {
+	if c.endpoint == "" {
+		return nil, errors.New("ai-endpoint is required for the openai provider")
+	}
+	if c.model == "" {
+		return nil, errors.New("ai-model is required for the openai provider")
+	}
+	return &openAIProvider{
+		client:   http.DefaultClient,
+		endpoint: strings.TrimSuffix(c.endpoint, "/"),
+		model:    c.model,
+		key:      c.key,
+	}, nil
+}
+
+// post sends the conversation to the chat completions endpoint and returns the open response
+func (o *openAIProvider) post(ctx context.Context, messages []aiMessage, stream bool) (*http.Response, error) {
+	req := openAIRequest{Model: o.model, Stream: stream}
+	for _, m := range messages {
+		role := m.Role
+		if role == "model" {
+			role = "assistant"
+		}
+		req.Messages = append(req.Messages, openAIMessage{Role: role, Content: m.Content})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, "POST", o.endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if o.key != "" {
+		hreq.Header.Set("Authorization", "Bearer "+o.key)
+	}
+	resp, err := o.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var r openAIResponse
+		if json.Unmarshal(data, &r) == nil && r.Error != nil {
+			return nil, errors.New(resp.Status + ": " + r.Error.Message)
+		}
+		return nil, errors.New(resp.Status + ": " + strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
+
+func (o *openAIProvider) ask(question string) (string, error) {
+	ctx := o.start()
+	defer o.cancel()
+	resp, err := o.post(ctx, []aiMessage{{Role: "user", Content: question}}, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var r openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	if len(r.Choices) == 0 {
+		return "", errors.New("empty response")
+	}
+	return r.Choices[0].Message.Content, nil
+}
+
+// stream reads the server sent events, one "data: {json}" line per chunk until "data: [DONE]"
+func (o *openAIProvider) stream(messages []aiMessage, chunk func(string)) error {
+	ctx := o.start()
+	defer o.cancel()
+	resp, err := o.post(ctx, messages, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var r openAIResponse
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return err
+		}
+		if r.Error != nil {
+			return errors.New(r.Error.Message)
+		}
+		if len(r.Choices) > 0 && r.Choices[0].Delta.Content != "" {
+			chunk(r.Choices[0].Delta.Content)
+		}
+	}
+	return scanner.Err()
+}
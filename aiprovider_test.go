@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubOpenAI starts a server for the chat completions endpoint that answers with handler
+func stubOpenAI(t *testing.T, handler http.HandlerFunc) *openAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	o, err := newOpenAIProvider(aiConfig{provider: "openai", endpoint: srv.URL + "/", model: "stub", key: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOpenAIStream(t *testing.T) {
+	o := stubOpenAI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream || len(req.Messages) != 2 || req.Messages[1].Role != "assistant" {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", c)
+		}
+		fmt.Fprint(w, ": keep-alive\n\ndata: [DONE]\n\n")
+	})
+	var got strings.Builder
+	err := o.stream([]aiMessage{{"user", "hi"}, {"model", "hey"}}, func(s string) { got.WriteString(s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "Hello" {
+		t.Errorf("stream = %q, want %q", got.String(), "Hello")
+	}
+}
+
+func TestOpenAIErrorBody(t *testing.T) {
+	o := stubOpenAI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"invalid key"}}`)
+	})
+	_, err := o.ask("hi")
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid key") {
+		t.Errorf("ask error = %v, want the status and the error message", err)
+	}
+
+	o = stubOpenAI(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	})
+	err = o.stream([]aiMessage{{"user", "hi"}}, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "upstream down") {
+		t.Errorf("stream error = %v, want the plain body", err)
+	}
+}
+
+func TestOpenAICancel(t *testing.T) {
+	o := stubOpenAI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"first\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// never finishes, the client has to cancel
+		<-r.Context().Done()
+	})
+	var chunks []string
+	err := o.stream([]aiMessage{{"user", "hi"}}, func(s string) {
+		chunks = append(chunks, s)
+		o.cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("stream error = %v, want context.Canceled", err)
+	}
+	if len(chunks) != 1 || chunks[0] != "first" {
+		t.Errorf("chunks = %q, want the chunk before the cancel", chunks)
+	}
+	o.cancel() // no request in progress, must not panic
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Values matched by these patterns are masked before sending text to the ai service
+// If a pattern has groups, only the first group matched is masked
+var aiSecretPatterns = []*regexp.Regexp{
+	// Private keys
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// Cloud and service tokens
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+	// Authorization headers and credentials in urls
+	regexp.MustCompile(`(?i)\b(?:bearer|basic)\s+([A-Za-z0-9._~+/=\-]{16,})`),
+	regexp.MustCompile(`://[^/\s:@]+:([^/\s@]+)@`),
+	aiAssignPattern,
+}
+
+// aiAssignPattern matches .env and config style assignments: DB_PASSWORD=..., api_key: ..., "secret": "..."
+// The value goes to the end of the line or a # comment, values that are code are skipped by aiCodeValue
+var aiAssignPattern = regexp.MustCompile(`(?im)^[ \t]*(?:export[ \t]+)?["']?[\w.\-]*(?:passw(?:or)?d|pass|secret|token|api_?key|access_?key|private_?key|credentials?)[\w.\-]*["']?[ \t]*(?::=|[:=])[ \t]*(?:"([^"\n]+)"|'([^'\n]+)'|([^\s"'#=][^\n]*?)[,;]?(?:[ \t]+#[^\n]*)?[ \t\r]*$)`)
+
+var (
+	aiCallValue  = regexp.MustCompile(`^[\w.$]+\s*\(`)
+	aiVarValue   = regexp.MustCompile(`^\$\{?\w+\}?$`)
+	aiIdentValue = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
+	aiCodeAssign = regexp.MustCompile(`(?:\s:?=|:?=\s)\s*$`)
+)
+
+// aiCodeValue checks if the unquoted value of an assignment is code and not a secret:
+// a function call like os.Getenv("KEY"), a $VAR reference, or an identifier assigned with spaces
+// around the = like token = config.Token. DB_PASSWORD=hunter2 and password: hunter2 are literals
+func aiCodeValue(assign, value string) bool {
+	if aiCallValue.MatchString(value) || aiVarValue.MatchString(value) {
+		return true
+	}
+	return aiIdentValue.MatchString(value) && aiCodeAssign.MatchString(assign)
+}
+
+// aiRedactPatterns returns the built-in patterns and the valid regexes of ai-redactpatterns
+func aiRedactPatterns() []*regexp.Regexp {
+	patterns := aiSecretPatterns
+	for _, exp := range StringListOption(globalSettings["ai-redactpatterns"]) {
+		r, err := regexp.Compile(exp)
+		if err != nil {
+			messenger.AddLog("ai-redactpatterns, invalid regex ", exp, ": ", err.Error())
+			continue
+		}
+		patterns = append(patterns, r)
+	}
+	return patterns
+}
+
+// aiPlaceholder is the text that replaces the n-th secret
+func aiPlaceholder(n int) string {
+	return fmt.Sprintf("[REDACTED-%d]", n)
+}
+
+// AIRedact masks the secrets found in text when ai-redact is on
+// Returns the masked text and the original values, secrets[i] was replaced by aiPlaceholder(i+1)
+func AIRedact(text string) (string, []string) {
+	var secrets []string
+	if !globalSettings["ai-redact"].(bool) {
+		return text, secrets
+	}
+	for _, r := range aiRedactPatterns() {
+		text = r.ReplaceAllStringFunc(text, func(match string) string {
+			sub := r.FindStringSubmatchIndex(match)
+			start, end := 0, len(match)
+			for i := 2; i+1 < len(sub); i += 2 {
+				if sub[i] >= 0 {
+					start, end = sub[i], sub[i+1]
+					break
+				}
+			}
+			if strings.HasPrefix(match[start:end], "[REDACTED-") {
+				return match
+			}
+			if r == aiAssignPattern && sub[6] >= 0 && aiCodeValue(match[:start], match[start:end]) {
+				return match
+			}
+			secrets = append(secrets, match[start:end])
+			return match[:start] + aiPlaceholder(len(secrets)) + match[end:]
+		})
+	}
+	return text, secrets
+}
+
+// AIRestore puts back the secrets masked by AIRedact
+func AIRestore(text string, secrets []string) string {
+	for i, secret := range secrets {
+		text = strings.ReplaceAll(text, aiPlaceholder(i+1), secret)
+	}
+	return text
+}
+
+// AIBlocked checks if the buffer must never be sent to the ai service
+func AIBlocked(b *Buffer) bool {
+	return aiBlockedFile(b.Path, b.FileType())
+}
+
+// aiBlockedFile checks a file by its path and file type
+// ai-blockfiles entries are file types or glob patterns matched against the full path or the file name
+func aiBlockedFile(path, filetype string) bool {
+	if path != "" {
+		path, _ = filepath.Abs(path)
+	}
+	for _, entry := range StringListOption(globalSettings["ai-blockfiles"]) {
+		if entry == filetype {
+			return true
+		}
+		if path == "" {
+			continue
+		}
+		entry = ReplaceHome(entry)
+		if ok, _ := filepath.Match(entry, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(entry, filepath.Base(path)); ok {
+			return true
+		}
+		if strings.HasSuffix(entry, "/") && strings.HasPrefix(path, entry) {
+			return true
+		}
+	}
+	return false
+}
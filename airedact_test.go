@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestAIRedactAssignments(t *testing.T) {
+	globalSettings = DefaultGlobalSettings()
+	tests := []struct {
+		line, want, secret string
+	}{
+		{"DB_PASSWORD=hunter2", "DB_PASSWORD=[REDACTED-1]", "hunter2"},
+		{"DB_PASSWORD=p@ss!w0rd#2024xyz", "DB_PASSWORD=[REDACTED-1]", "p@ss!w0rd#2024xyz"},
+		{"export API_KEY=abc # dev key", "export API_KEY=[REDACTED-1] # dev key", "abc"},
+		{"password: s3cr3t!\r", "password: [REDACTED-1]\r", "s3cr3t!"},
+		{`"secret": "x y",`, `"secret": "[REDACTED-1]",`, "x y"},
+		{"token = 'abc' + suffix", "token = '[REDACTED-1]' + suffix", "abc"},
+		{"pass=12345;", "pass=[REDACTED-1];", "12345"},
+		// code is not a secret
+		{`token := os.Getenv("TOKEN")`, "", ""},
+		{"token = getToken()", "", ""},
+		{"password = config.Password", "", ""},
+		{"DB_PASSWORD=${PASSWORD}", "", ""},
+		{"if password == other {", "", ""},
+	}
+	for _, tt := range tests {
+		got, secrets := AIRedact(tt.line)
+		if tt.want == "" {
+			if got != tt.line || len(secrets) != 0 {
+				t.Errorf("%q redacted to %q", tt.line, got)
+			}
+			continue
+		}
+		if got != tt.want || len(secrets) != 1 || secrets[0] != tt.secret {
+			t.Errorf("%q redacted to %q %q, want %q %q", tt.line, got, secrets, tt.want, tt.secret)
+		}
+		if AIRestore(got, secrets) != tt.line {
+			t.Errorf("%q not restored", tt.line)
+		}
+	}
+}
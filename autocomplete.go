@@ -83,6 +83,7 @@ func GroupComplete(group, input string) (string, []string) {
 	var suggestions []string
 	var options []string
 	var chosen = ""
+	args := strings.Fields(group)
 	i := strings.Index(group, ":")
 	group = group[0:i]
 	switch group {
@@ -91,11 +92,24 @@ func GroupComplete(group, input string) (string, []string) {
 	case "config":
 		options = []string{"buffersettings", "cloudsettings", "keybindings", "plugins", "settings"}
 	case "gemini":
-		options = []string{"ask", "selection", "buffer"}
+		options = []string{"ask", "attach", "buffer", "cancel", "edit", "history", "new", "selection"}
+		if len(args) > 2 {
+			// Complete the argument of the option
+			switch args[1] {
+			case "attach":
+				options = []string{"buffer", "function", "selection"}
+			case "history":
+				options = geminiChatNames()
+			default:
+				options = nil
+			}
+		}
 	case "git":
-		options = []string{"diff", "diffstaged", "status"}
+		options = []string{"blame", "branch", "commit", "diff", "diffsplit", "diffstaged", "filelog", "log", "revert", "show", "stage", "stash", "status", "unstage"}
+	case "search":
+		options = []string{"grep", "references", "rename", "replace"}
 	case "show":
-		options = []string{"snippets"}
+		options = []string{"snippets", "undotree"}
 	}
 	for _, cmd := range options {
 		if strings.HasPrefix(cmd, input) {
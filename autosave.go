@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+)
+
+// Autosave, the modified buffers are saved every autosave-interval seconds, when the focus
+// leaves their view, when their tab is left, or before quitting, depending on the autosave options.
+// Only files are saved, like a manual save, removing trailing whitespace and running the formatter
+
+var (
+	autosaveTimer *time.Timer
+	// view and tab with the focus after the last event, to detect the focus changes
+	autosaveView *View
+	autosaveTab  *Tab
+)
+
+// autosave saves the buffer of the view if it has changes, returns true if it was saved
+// Buffers of views with an onClose action, like the commit composer, are only saved by the user
+func (v *View) autosave() bool {
+	b := v.Buf
+	if v.Type != vtDefault || b.RO || b.Path == "" || !b.Modified() {
+		return false
+	}
+	for _, t := range tabs {
+		for _, tv := range t.Views {
+			if tv.Buf == b && tv.onClose != nil {
+				return false
+			}
+		}
+	}
+	if currentSnippet != nil && currentSnippet.view.Buf == b {
+		return false
+	}
+	if modTime, ok := GetModTime(b.Path); ok && modTime != b.ModTime {
+		// changed on disk, the reload is asked first
+		return false
+	}
+	if !PreActionCall("Save", v) {
+		return false
+	}
+	if err := b.Save(); err != nil {
+		messenger.Error("Autosave of ", b.GetName(), " failed: ", err.Error())
+		return false
+	}
+	if b.RunFormatter() {
+		v.ReOpen()
+	}
+	PostActionCall("Save", v)
+	return true
+}
+
+// autosaveViews saves the buffers of the views, each buffer once
+func autosaveViews(views []*View) {
+	seen := make(map[*Buffer]bool)
+	n := 0
+	for _, v := range views {
+		if !seen[v.Buf] && v.autosave() {
+			n++
+		}
+		seen[v.Buf] = true
+	}
+	if n > 0 {
+		git.GitSetStatus()
+		messenger.Information("Autosaved ", n, " files")
+	}
+}
+
+// AutosaveAll saves all the modified buffers
+func AutosaveAll() {
+	var views []*View
+	for _, t := range tabs {
+		views = append(views, t.Views...)
+	}
+	autosaveViews(views)
+}
+
+// StartAutosave schedules the saves of autosave-interval, it is called again when the option changes
+func StartAutosave() {
+	if autosaveTimer != nil {
+		autosaveTimer.Stop()
+		autosaveTimer = nil
+	}
+	interval := globalSettings["autosave-interval"].(float64)
+	if interval <= 0 {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Duration(interval*float64(time.Second)), func() {
+		jobs <- JobFunction{func(string, ...string) {
+			// the timer was replaced while the job was waiting
+			if t != autosaveTimer {
+				return
+			}
+			AutosaveAll()
+			StartAutosave()
+		}, "", nil}
+	})
+	autosaveTimer = t
+}
+
+// AutosaveOnFocus saves the buffers left since the last event, called by the main loop
+// autosave-focus saves the buffer of the view that lost the focus, autosave-tab the buffers of the tab left
+func AutosaveOnFocus() {
+	v := CurView()
+	if v == autosaveView {
+		return
+	}
+	last, lastTab := autosaveView, autosaveTab
+	autosaveView, autosaveTab = v, tabs[curTab]
+	if last == nil || !viewOpen(last) {
+		return
+	}
+	if lastTab != autosaveTab && globalSettings["autosave-tab"].(bool) {
+		autosaveViews(lastTab.Views)
+	} else if globalSettings["autosave-focus"].(bool) {
+		autosaveViews([]*View{last})
+	}
+}
+
+// viewOpen checks if the view is still in a tab
+func viewOpen(v *View) bool {
+	for _, t := range tabs {
+		for _, tv := range t.Views {
+			if tv == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -19,6 +19,9 @@ var mouseBindingActions = map[string]func(*View, bool, *tcell.EventMouse) bool{
 }
 
 var bindingActions = map[string]func(*View, bool) bool{
+	"AcceptBoth":              (*View).AcceptBoth,
+	"AcceptOurs":              (*View).AcceptOurs,
+	"AcceptTheirs":            (*View).AcceptTheirs,
 	"AddTab":                  (*View).AddTab,
 	"Backspace":               (*View).Backspace,
 	"BufferSettings":          (*View).BufferSettings,
@@ -50,6 +53,7 @@ var bindingActions = map[string]func(*View, bool) bool{
 	"FindPrevious":            (*View).FindPrevious,
 	"FindDialog":              (*View).FindDialog,
 	"FindFunctionDeclaration": (*View).FindFunctionDeclaration,
+	"FindReferences":          (*View).FindReferences,
 	"HintFunction":            (*View).HintFunction,
 	"HSplit":                  (*View).HSplitBinding,
 	"IndentSelection":         (*View).IndentSelection,
@@ -62,6 +66,9 @@ var bindingActions = map[string]func(*View, bool) bool{
 	"MoveLinesDown":           (*View).MoveLinesDown,
 	"MultiComment":            (*View).MultiComment,
 	"NavigationMode":          (*View).NavigationMode,
+	"NextConflict":            (*View).NextConflict,
+	"NextHunk":                (*View).NextHunk,
+	"NextResult":              (*View).NextResult,
 	"NextTab":                 (*View).NextTab,
 	"NextSplit":               (*View).NextSplit,
 	"OutdentSelection":        (*View).OutdentSelection,
@@ -72,6 +79,8 @@ var bindingActions = map[string]func(*View, bool) bool{
 	"PasteCloud":              (*View).PasteCloud,
 	"ParagraphPrevious":       (*View).ParagraphPrevious,
 	"ParagraphNext":           (*View).ParagraphNext,
+	"PreviousHunk":            (*View).PreviousHunk,
+	"PreviousResult":          (*View).PreviousResult,
 	"PreviousTab":             (*View).PreviousTab,
 	"PreviousSplit":           (*View).PreviousSplit,
 	"Quit":                    (*View).SafeQuit,
@@ -80,6 +89,8 @@ var bindingActions = map[string]func(*View, bool) bool{
 	"Redo":                    (*View).Redo,
 	"RemoveMultiCursor":       (*View).RemoveMultiCursor,
 	"RemoveAllMultiCursors":   (*View).RemoveAllMultiCursors,
+	"RenameSymbol":            (*View).RenameSymbol,
+	"RevertHunk":              (*View).RevertHunk,
 	"Save":                    (*View).Save,
 	"SaveAll":                 (*View).SaveAll,
 	"SaveAs":                  (*View).SaveAs,
@@ -108,12 +119,16 @@ var bindingActions = map[string]func(*View, bool) bool{
 	"SnippetNext":             (*View).SnippetNext,
 	"StartOfLine":             (*View).StartOfLine,
 	"SpawnMultiCursor":        (*View).SpawnMultiCursor,
+	"StageHunk":               (*View).StageHunk,
 	"SpawnMultiCursorSelect":  (*View).SpawnMultiCursorSelect,
 	"ToggleCase":              (*View).ToggleCase,
 	"ToggleRuler":             (*View).ToggleRuler,
 	"ToggleSoftWrap":          (*View).ToggleSoftWrap,
 	"ToggleOverwriteMode":     (*View).ToggleOverwriteMode,
 	"Undo":                    (*View).Undo,
+	"UndoNewer":               (*View).UndoNewer,
+	"UndoOlder":               (*View).UndoOlder,
+	"UnstageHunk":             (*View).UnstageHunk,
 	"Unsplit":                 (*View).Unsplit,
 	"VSplit":                  (*View).VSplitBinding,
 	"WordRight":               (*View).WordRight,
@@ -625,10 +640,20 @@ func ComboKeyBindings() {
 		'f': {(*View).OpenDirView},
 		'g': {(*View).FindFunctionDeclaration},
 		'h': {(*View).HintFunction},
+		'i': {(*View).PreviousHunk},
+		'j': {(*View).NextConflict},
+		'k': {(*View).NextHunk},
 		'l': {(*View).SelectLine},
+		'm': {(*View).AcceptBoth},
+		'n': {(*View).NextResult},
+		'N': {(*View).PreviousResult},
+		'o': {(*View).AcceptOurs},
 		'p': {(*View).ToggleMouse},
+		'r': {(*View).FindReferences},
+		'R': {(*View).RenameSymbol},
 		's': {(*View).SelectWordLeft},
 		'S': {(*View).SaveAll},
+		't': {(*View).AcceptTheirs},
 		'u': {(*View).DeleteWord},
 		'v': {(*View).PasteCloud},
 		'w': {(*View).SelectWord},
@@ -638,6 +663,8 @@ func ComboKeyBindings() {
 		'|': {(*View).VSplitBinding},
 		'-': {(*View).HSplitBinding},
 		'/': {(*View).MultiComment},
+		',': {(*View).UndoOlder},
+		'.': {(*View).UndoNewer},
 		'*': {(*View).BufferSettings},
 	}
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// Git blame, a read only split next to the file with the commit, author and date of every line
+// The buffer text is sent to git blame, so the lines stay aligned with unsaved changes
+
+// blameCommit is the information of a commit in git blame --porcelain
+type blameCommit struct {
+	hash    string
+	author  string
+	time    int64
+	summary string
+}
+
+// gitBlame are the commits of each line of the source view
+type gitBlame struct {
+	root  string
+	lines []*blameCommit
+}
+
+// parseBlame reads the output of git blame --porcelain, the commit of each line in order
+// The details of a commit are only given the first time it appears
+func parseBlame(out string) []*blameCommit {
+	var lines []*blameCommit
+	commits := make(map[string]*blameCommit)
+	var cur *blameCommit
+	for l := range strings.SplitSeq(out, "\n") {
+		if strings.HasPrefix(l, "\t") {
+			lines = append(lines, cur)
+			continue
+		}
+		key, value, _ := strings.Cut(l, " ")
+		switch key {
+		case "author":
+			cur.author = value
+		case "author-time":
+			cur.time, _ = strconv.ParseInt(value, 10, 64)
+		case "summary":
+			cur.summary = value
+		default:
+			// the header of a line: <hash> <original line> <final line> [<lines in group>]
+			// sha1 or sha256 repositories
+			if (len(key) == 40 || len(key) == 64) && strings.Trim(key, "0123456789abcdef") == "" {
+				if commits[key] == nil {
+					commits[key] = &blameCommit{hash: key}
+				}
+				cur = commits[key]
+			}
+		}
+	}
+	return lines
+}
+
+// render a line for each line of the source
+func (g *gitBlame) render() string {
+	var sb strings.Builder
+	for _, c := range g.lines {
+		if c == nil || strings.Trim(c.hash, "0") == "" {
+			sb.WriteString("-------- Not committed yet\n")
+			continue
+		}
+		author := []rune(c.author)
+		if len(author) > 16 {
+			author = author[:16]
+		}
+		date := time.Unix(c.time, 0).Format("2006-01-02")
+		fmt.Fprintf(&sb, "%s %-16s %s %s\n", c.hash[:8], string(author), date, c.summary)
+	}
+	return sb.String()
+}
+
+// GitBlame opens the blame of the current buffer in a split that scrolls with it
+func GitBlame() {
+	v := CurView()
+	if v.Type != vtDefault || v.Buf.Path == "" {
+		messenger.Warning("Blame only works on files")
+		return
+	}
+	path, _ := filepath.Abs(v.Buf.Path)
+	root, rel, err := gitRepoPath(path)
+	if err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	cmd := exec.Command("git", "-C", root, "blame", "--porcelain", "--contents", "-", "--", rel)
+	cmd.Stdin = strings.NewReader(v.Buf.String())
+	out, err := cmd.Output()
+	if err != nil {
+		messenger.Error("git blame failed, is ", rel, " tracked?")
+		return
+	}
+	g := &gitBlame{root: root, lines: parseBlame(string(out))}
+	w := v.Width
+	v.VSplitIndex(NewBufferFromString(g.render(), ""), v.Num+1)
+	blame := CurView()
+	blame.Type = vtLog
+	blame.Buf.Settings["filetype"] = "git-blame"
+	blame.Buf.UpdateRules()
+	blame.Buf.Fname = "blame " + v.Buf.Fname
+	SetLocalOption("ruler", "false", blame)
+	SetLocalOption("softwrap", "false", blame)
+	SetLocalOption("softwrap", "false", v)
+	nv := min(60, w/2)
+	v.Width = w - nv
+	blame.Width = w - v.Width
+	blame.x = v.x + v.Width + 1
+	blame.syncView = v
+	v.syncView = blame
+	blame.onKey = g.key
+	blame.Topline = v.Topline
+	blame.Cursor.GotoLoc(Loc{0, min(v.Cursor.Y, blame.Buf.LinesNum()-1)})
+	navigationMode = true
+	messenger.Information("Enter shows the commit of the line")
+}
+
+// key opens the commit of the line under the cursor on Enter
+func (g *gitBlame) key(v *View, e *tcell.EventKey) bool {
+	if e.Key() != tcell.KeyEnter {
+		return false
+	}
+	y := v.Cursor.Y
+	if y >= len(g.lines) || g.lines[y] == nil || strings.Trim(g.lines[y].hash, "0") == "" {
+		messenger.Information("Line not committed yet")
+		return true
+	}
+	GitShow(g.root, g.lines[y].hash)
+	return true
+}
+
+// GitShow opens git show of the commit in a new tab, limited to the paths if any
+func GitShow(root, hash string, paths ...string) {
+	args := []string{"-C", root, "show", "--stat", "--patch", hash}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		messenger.Error("git show failed: ", strings.TrimSpace(string(out)))
+		return
+	}
+	CurView().AddTab(false)
+	CurView().OpenBuffer(NewBufferFromString(string(out), ""))
+	CurView().Buf.Settings["filetype"] = "git-diff"
+	CurView().Type = vtLog
+	CurView().Buf.UpdateRules()
+	CurView().Buf.Fname = "git-show " + hash[:min(8, len(hash))]
+	SetLocalOption("softwrap", "true", CurView())
+	SetLocalOption("ruler", "false", CurView())
+	navigationMode = true
+}
@@ -21,7 +21,7 @@ import (
 	"github.com/phayes/permbits"
 )
 
-// LargeFileThreshold Define a large file limit reference
+// LargeFileThreshold number of lines above which a file is stored in a piece table
 const LargeFileThreshold = 50000
 
 var (
@@ -32,12 +32,12 @@ var (
 )
 
 // Buffer stores the text for files that are loaded into the text editor
-// It uses a rope to efficiently store the string and contains some
-// simple functions for saving and wrapper functions for modifying the rope
+// The text is a LineArray, an array of lines or a piece table for large files, and it contains
+// some simple functions for saving and wrapper functions for modifying the text
 type Buffer struct {
 	// The eventhandler for undo/redo
 	*EventHandler
-	// This stores all the text in the buffer as an array of lines
+	// This stores all the text in the buffer as an array of lines, or a piece table
 	*LineArray
 
 	Cursor    Cursor
@@ -61,10 +61,6 @@ type Buffer struct {
 	IsModified bool
 	RO         bool
 
-	// Stack Reference since saved, used to set buffer clean if undos arrives to
-	// last clean state (monitors in Undo Redo Actions)
-	UndoStackRef int
-
 	// Stores the last modification time of the file the buffer is pointing to
 	ModTime time.Time
 
@@ -74,6 +70,17 @@ type Buffer struct {
 	syntaxDef   *highlight.Def
 	highlighter *highlight.Highlighter
 
+	// Changes against the version of the file in git, nil if the file is not in a repository
+	gitDiff *gitGutter
+
+	// Merge conflict regions, nil when the file has none
+	conflicts []conflict
+
+	// Undo state written to the swap file, nil without swap file
+	swapState *undoNode
+	// the swap file of a large file is being written in the background
+	swapPending bool
+
 	// Buffer local settings
 	Settings map[string]any
 
@@ -242,6 +249,16 @@ func NewBuffer(reader io.Reader, size int64, path string) *Buffer {
 
 	b.cursors = []*Cursor{&b.Cursor}
 	b.pasteLoc.X = -1
+	if reflect.TypeOf(reader).String() == "*os.File" && path != "" {
+		// Start indexing the project of the file in the background
+		ProjectSymbols(b)
+		b.UpdateGitBase()
+		b.LoadUndoHistory()
+		b.CheckSwap()
+		if b.UpdateConflicts(); len(b.conflicts) > 0 {
+			b.Cursor.GotoLoc(Loc{0, b.conflicts[0].start})
+		}
+	}
 	return b
 }
 
@@ -312,7 +329,7 @@ func (b *Buffer) UpdateRules() {
 
 			ft := b.Settings["filetype"].(string)
 			if ft == "" && !rehighlight {
-				if highlight.MatchFiletype(ftdetect, b.Path, b.lines[0].data) {
+				if highlight.MatchFiletype(ftdetect, b.Path, b.LineBytes(0)) {
 					header := new(highlight.Header)
 					header.FileType = file.FileType
 					header.FtDetect = ftdetect
@@ -568,15 +585,20 @@ func (b *Buffer) CheckModTime() {
 				messenger.Alert("info", Language.Translate("Buffer reloaded"))
 				b.ReOpen()
 			} else {
-				choice, canceled := messenger.YesNoPrompt(Language.Translate("The file has changed since it was last read. Reload file? (y,n)"))
+				y := []rune(Language.Translate("y"))[0]
+				d := []rune(Language.Translate("d"))[0]
+				choice, canceled := messenger.LetterPrompt(true, Language.Translate("The file has changed since it was last read. Reload file? (y,n,d to diff with disk)"), y, []rune(Language.Translate("n"))[0], d)
 				messenger.Reset()
 				messenger.Clear()
-				if !choice || canceled {
-					// Don't load new changes -- do nothing
-					b.ModTime, _ = GetModTime(b.Path)
-				} else {
+				if choice == y && !canceled {
 					// Load new changes
 					b.ReOpen()
+				} else {
+					// Don't load new changes, they can be compared with the buffer
+					b.ModTime, _ = GetModTime(b.Path)
+					if choice == d && !canceled {
+						b.DiffWithDisk()
+					}
 				}
 			}
 		}
@@ -614,12 +636,13 @@ func (b *Buffer) ReOpen() {
 	b.Update()
 	b.SmartDetections()
 	git.GitSetStatus()
+	b.UpdateGitGutter()
 	b.Cursor.Relocate()
 }
 
-// Update fetches the string from the rope and updates the `text` and `lines` in the buffer
+// Update refreshes the number of lines of the buffer after the text changed
 func (b *Buffer) Update() {
-	b.NumLines = len(b.lines)
+	b.NumLines = b.LinesNum()
 }
 
 // MergeCursors merges any cursors that are at the same position
@@ -666,10 +689,11 @@ func (b *Buffer) Save() error {
 func (b *Buffer) SaveAs(filename string) error {
 	b.UpdateRules()
 	if b.Settings["rmtrailingws"].(bool) {
-		for i, l := range b.lines {
-			pos := len(bytes.TrimRightFunc(l.data, unicode.IsSpace))
+		for i := range b.LinesNum() {
+			l := b.LineBytes(i)
+			pos := len(bytes.TrimRightFunc(l, unicode.IsSpace))
 
-			if pos < len(l.data) {
+			if pos < len(l) {
 				b.deleteToEnd(Loc{pos, i})
 			}
 		}
@@ -731,7 +755,7 @@ func (b *Buffer) SaveAs(filename string) error {
 		} else {
 			fileutf8 = file
 		}
-		if len(b.lines) == 0 {
+		if b.LinesNum() == 0 {
 			return
 		}
 
@@ -742,20 +766,21 @@ func (b *Buffer) SaveAs(filename string) error {
 		}
 
 		// write lines
-		if fileSize, e = fileutf8.Write(b.lines[0].data); e != nil {
+		if fileSize, e = fileutf8.Write(b.LineBytes(0)); e != nil {
 			return
 		}
 
-		for _, l := range b.lines[1:] {
+		for i := 1; i < b.LinesNum(); i++ {
+			l := b.LineBytes(i)
 			if _, e = fileutf8.Write(eol); e != nil {
 				return
 			}
 
-			if _, e = fileutf8.Write(l.data); e != nil {
+			if _, e = fileutf8.Write(l); e != nil {
 				return
 			}
 
-			fileSize += len(eol) + len(l.data)
+			fileSize += len(eol) + len(l)
 		}
 
 		return
@@ -774,6 +799,8 @@ func (b *Buffer) SaveAs(filename string) error {
 		}
 	}
 
+	// saved, the swap file of the old path is no longer needed
+	b.RemoveSwap()
 	b.Path = filename
 	b.IsModified = false
 	if b.encoder != "UTF8" {
@@ -786,8 +813,12 @@ func (b *Buffer) SaveAs(filename string) error {
 			messenger.Alert("error", Language.Translate("Could not save settings")+" : "+err.Error())
 		}
 	}
-	// Save current Undo Stack Len to later check Modified status in Actions
-	b.UndoStackRef = b.EventHandler.UndoStack.Len()
+	// Save the current undo state to later check Modified status in Actions
+	b.UndoTree.MarkSaved()
+	IndexSavedFile(b)
+	b.UpdateGitGutter()
+	b.UpdateConflicts()
+	b.SaveUndoHistory()
 	return nil
 }
 
@@ -861,7 +892,7 @@ func (b *Buffer) Start() Loc {
 
 // End returns the location of the last character in the buffer
 func (b *Buffer) End() Loc {
-	return Loc{utf8.RuneCount(b.lines[b.NumLines-1].data), b.NumLines - 1}
+	return Loc{utf8.RuneCount(b.LineBytes(b.NumLines - 1)), b.NumLines - 1}
 }
 
 // RuneAt returns the rune at a given location in the buffer
@@ -873,20 +904,12 @@ func (b *Buffer) RuneAt(loc Loc) rune {
 	return '\n'
 }
 
-// LineBytes returns a single line as an array of bytes
-func (b *Buffer) LineBytes(n int) []byte {
-	if n >= len(b.lines) {
-		return []byte{}
-	}
-	return b.lines[n].data
-}
-
 // LineRunes returns a single line as an array of runes
 func (b *Buffer) LineRunes(n int) []rune {
-	if n >= len(b.lines) {
+	if n >= b.LinesNum() {
 		return []rune{}
 	}
-	return toRunes(b.lines[n].data)
+	return toRunes(b.LineBytes(n))
 }
 
 // LineLen returns the length of a line
@@ -896,35 +919,29 @@ func (b *Buffer) LineLen(n int) int {
 
 // Line returns a single line
 func (b *Buffer) Line(n int) string {
-	if n >= len(b.lines) {
+	if n >= b.LinesNum() {
 		return ""
 	}
-	return string(b.lines[n].data)
-}
-
-// LinesNum returns the number of lines in the buffer
-func (b *Buffer) LinesNum() int {
-	return len(b.lines)
+	return string(b.LineBytes(n))
 }
 
 // Lines returns an array of strings containing the lines from start to end
 func (b *Buffer) Lines(start, end int) []string {
-	lines := b.lines[start:end]
 	var slice []string
-	for _, line := range lines {
-		slice = append(slice, string(line.data))
+	for i := start; i < end; i++ {
+		slice = append(slice, string(b.LineBytes(i)))
 	}
 	return slice
 }
 
 // Len gives the length of the buffer
 func (b *Buffer) Len() (n int) {
-	for _, l := range b.lines {
-		n += utf8.RuneCount(l.data)
+	for i := range b.LinesNum() {
+		n += utf8.RuneCount(b.LineBytes(i))
 	}
 
-	if len(b.lines) > 1 {
-		n += len(b.lines) - 1 // account for newlines
+	if b.LinesNum() > 1 {
+		n += b.LinesNum() - 1 // account for newlines
 	}
 
 	return
@@ -932,14 +949,14 @@ func (b *Buffer) Len() (n int) {
 
 // MoveLinesUp moves the range of lines up one row
 func (b *Buffer) MoveLinesUp(start int, end int) {
-	// 0 < start < end <= len(b.lines)
-	if start < 1 || start >= end || end > len(b.lines) {
+	// 0 < start < end <= b.LinesNum()
+	if start < 1 || start >= end || end > b.LinesNum() {
 		return // what to do? FIXME
 	}
-	if end == len(b.lines) {
+	if end == b.LinesNum() {
 		b.Insert(
 			Loc{
-				utf8.RuneCount(b.lines[end-1].data),
+				utf8.RuneCount(b.LineBytes(end - 1)),
 				end - 1,
 			},
 			"\n"+b.Line(start-1),
@@ -958,10 +975,10 @@ func (b *Buffer) MoveLinesUp(start int, end int) {
 
 // MoveLinesDown moves the range of lines down one row
 func (b *Buffer) MoveLinesDown(start int, end int) {
-	// 0 <= start < end < len(b.lines)
-	// if end == len(b.lines), we can't do anything here because the
+	// 0 <= start < end < b.LinesNum()
+	// if end == b.LinesNum(), we can't do anything here because the
 	// last line is unaccessible, FIXME
-	if start < 0 || start >= end || end >= len(b.lines)-1 {
+	if start < 0 || start >= end || end >= b.LinesNum()-1 {
 		return // what to do? FIXME
 	}
 	b.Insert(
@@ -988,7 +1005,7 @@ func (b *Buffer) RemoveTrailingSpace(pos Loc) {
 
 // ClearMatches clears all of the syntax highlighting for this buffer
 func (b *Buffer) ClearMatches() {
-	for i := range b.lines {
+	for i := range b.LinesNum() {
 		b.SetMatch(i, nil)
 		b.SetState(i, nil)
 	}
@@ -1039,7 +1056,7 @@ func (b *Buffer) FindMatchingBrace(braceType [2]rune, start Loc) Loc {
 		}
 	case braceType[1]:
 		for y := start.Y; y >= 0; y-- {
-			l := []rune(string(b.lines[y].data))
+			l := []rune(string(b.LineBytes(y)))
 			xInit := len(l) - 1
 			if y == start.Y {
 				xInit = start.X
@@ -1081,7 +1098,7 @@ func (b *Buffer) ChangeIndentation(cfrom, cto string, nfrom, nto int) {
 		ws := GetLeadingWhitespace(l)
 		wt := strings.ReplaceAll(ws, ss, sr)
 		newline := strings.Replace(l, ws, wt, 1)
-		b.lines[y].data = []byte(newline)
+		b.setLine(y, []byte(newline))
 	}
 	b.IsModified = true
 }
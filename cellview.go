@@ -117,9 +117,9 @@ func (c *CellView) Draw(buf *Buffer, top, height, left, width int, ActiveView bo
 	// Highlite Buffer
 	if buf.Settings["syntax"].(bool) && buf.syntaxDef != nil {
 		buf.highlighter.SetDimensions(top, left, width, height)
-		if start > 0 && buf.lines[start-1].rehighlight {
+		if start > 0 && buf.Rehighlight(start-1) {
 			buf.highlighter.ReHighlightLine(buf, start-1)
-			buf.lines[start-1].rehighlight = false
+			buf.SetRehighlight(start-1, false)
 		}
 
 		buf.highlighter.ReHighlightStates(buf, start)
@@ -131,7 +131,7 @@ func (c *CellView) Draw(buf *Buffer, top, height, left, width int, ActiveView bo
 
 	viewLine := 0
 	lineN := top
-	bufEnd := len(buf.lines)
+	bufEnd := buf.LinesNum()
 	curStyle := defStyle
 
 	for viewLine < height {
@@ -37,13 +37,16 @@ func init() {
 		"Gemini":      GeminiAsk,
 		"Help":        Help,
 		"MemUsage":    MemUsage,
+		"DiskDiff":    DiskDiff,
 		"Open":        Open,
+		"PurgeUndo":   PurgeUndo,
 		"Pwd":         Pwd,
 		"Reload":      Reload,
 		"SaveAs":      SaveAs,
 		"ToggleLog":   ToggleLog,
 		"GroupEdit":   GroupEdit,
 		"GroupGemini": GroupGemini,
+		"GroupSearch": GroupSearch,
 		"GroupGit":    GroupGit,
 		"GroupConfig": GroupConfig,
 		"GroupShow":   GroupShow,
@@ -54,20 +57,23 @@ func init() {
 // DefaultCommands returns a map containing mi-ide's default commands
 func DefaultCommands() map[string]StrCommand {
 	return map[string]StrCommand{
-		"cd":       {"Cd", []Completion{FileCompletion}},
-		"help":     {"Help", []Completion{HelpCompletion, NoCompletion}},
-		"log":      {"ToggleLog", []Completion{NoCompletion}},
-		"memusage": {"MemUsage", []Completion{NoCompletion}},
-		"open":     {"Open", []Completion{FileCompletion}},
-		"pwd":      {"Pwd", []Completion{NoCompletion}},
-		"quit":     {"Exit", []Completion{NoCompletion}},
-		"reload":   {"Reload", []Completion{NoCompletion}},
-		"save":     {"SaveAs", []Completion{FileCompletion}},
+		"cd":        {"Cd", []Completion{FileCompletion}},
+		"diff":      {"DiskDiff", []Completion{NoCompletion}},
+		"help":      {"Help", []Completion{HelpCompletion, NoCompletion}},
+		"log":       {"ToggleLog", []Completion{NoCompletion}},
+		"memusage":  {"MemUsage", []Completion{NoCompletion}},
+		"open":      {"Open", []Completion{FileCompletion}},
+		"purgeundo": {"PurgeUndo", []Completion{NoCompletion}},
+		"pwd":       {"Pwd", []Completion{NoCompletion}},
+		"quit":      {"Exit", []Completion{NoCompletion}},
+		"reload":    {"Reload", []Completion{NoCompletion}},
+		"save":      {"SaveAs", []Completion{FileCompletion}},
 		// Groups
 		"config:": {"GroupConfig", []Completion{GroupCompletion, NoCompletion}},
 		"edit:":   {"GroupEdit", []Completion{GroupCompletion, NoCompletion}},
-		"gemini:": {"GroupGemini", []Completion{GroupCompletion, NoCompletion}},
+		"gemini:": {"GroupGemini", []Completion{GroupCompletion, GroupCompletion, NoCompletion}},
 		"git:":    {"GroupGit", []Completion{GroupCompletion, NoCompletion}},
+		"search:": {"GroupSearch", []Completion{GroupCompletion, NoCompletion}},
 		"show:":   {"GroupShow", []Completion{GroupCompletion, NoCompletion}},
 	}
 }
@@ -127,49 +133,168 @@ func CommandAction(cmd string) func(*View, bool) bool {
 	}
 }
 
-// Gemini ask gemini
+// geminiReady connects to the ai provider if needed
+func geminiReady() bool {
+	if gemini == nil {
+		gemini = GenaiNew()
+	}
+	if gemini == nil || gemini.provider == nil && !gemini.connect() {
+		messenger.AddLog(aiName(), ", not available, check you have an API Key in ", globalSettings["ai-keyenv"])
+		return false
+	}
+	return true
+}
+
+// GeminiAsk ask gemini, follow up questions continue the current conversation
 func GeminiAsk(args []string) {
 	if len(args) < 4 {
 		messenger.Warning("Question is too short")
 		return
 	}
-	if gemini == nil {
-		gemini = GenaiNew()
-		if gemini == nil {
-			messenger.AddLog("Gemini, not available, check you have a Gemini API Key")
-			return
-		}
+	if !geminiReady() {
+		return
 	}
 	question := strings.Join(args, " ")
 	gemini.ask(question)
 }
 
+// geminiAskAttached ask gemini with the selection or the buffer attached
+// The attachment is dropped if the question is refused, so it is not sent with the next one
+func geminiAskAttached(what string, args []string) {
+	if len(args) < 4 {
+		messenger.Warning("Question is too short")
+		return
+	}
+	if !geminiReady() {
+		return
+	}
+	n := len(gemini.attachments)
+	if GeminiAttach([]string{what}) && !gemini.ask(strings.Join(args, " ")) {
+		gemini.attachments = gemini.attachments[:n]
+	}
+}
+
+// GeminiAskSelection ask gemini with the current selection attached
 func GeminiAskSelection(args []string) {
 	if CurView().Cursor.HasSelection() {
-		if len(args) < 4 {
-			messenger.Warning("Question is too short")
-			return
-		}
-		args = append(args, CurView().Cursor.GetSelection())
-		GeminiAsk(args)
+		geminiAskAttached("selection", args)
 	} else {
 		messenger.Warning("Need a selection to ask")
 	}
 }
 
+// GeminiAskBuffer ask gemini with the current buffer attached
 func GeminiAskBuffer(args []string) {
 	if CurView().Buf.LinesNum() > 5 {
-		if len(args) < 4 {
-			messenger.Warning("Question is too short")
-			return
-		}
-		args = append(args, CurView().Buf.String())
-		GeminiAsk(args)
+		geminiAskAttached("buffer", args)
 	} else {
 		messenger.Warning("Buffer is too short")
 	}
 }
 
+// GeminiEdit ask gemini to change the selection, the result is shown as a diff to accept or discard
+func GeminiEdit(args []string) {
+	v := CurView()
+	if v.Buf.RO || v.Type.Readonly {
+		messenger.Warning("Buffer is read only")
+		return
+	}
+	if !v.Cursor.HasSelection() {
+		messenger.Warning("Need a selection to edit")
+		return
+	}
+	if AIBlocked(v.Buf) {
+		messenger.Warning(v.Buf.GetName(), " is blocked by ai-blockfiles, not sent")
+		return
+	}
+	if len(args) < 2 {
+		messenger.Warning("Instruction is too short")
+		return
+	}
+	if !geminiReady() {
+		return
+	}
+	gemini.edit(v, strings.Join(args, " "))
+}
+
+// GeminiAttach add the selection, buffer or function under the cursor as context for the next question
+func GeminiAttach(args []string) bool {
+	v := CurView()
+	if v.Type == vtLog {
+		messenger.Warning("Attach from an edit view")
+		return false
+	}
+	if AIBlocked(v.Buf) {
+		messenger.Warning(v.Buf.GetName(), " is blocked by ai-blockfiles, not sent")
+		return false
+	}
+	if !geminiReady() {
+		return false
+	}
+	switch args[0] {
+	case "selection":
+		if !v.Cursor.HasSelection() {
+			messenger.Warning("Need a selection to attach")
+			return false
+		}
+		gemini.attach("selection from "+v.Buf.GetName(), v.Cursor.GetSelection())
+	case "buffer":
+		gemini.attach("file "+v.Buf.GetName(), v.Buf.String())
+	case "function":
+		// the declaration can be in another file, it is checked against ai-blockfiles too
+		ok, where, word, line := v.SearchFunction(false)
+		if !ok {
+			if word != "" {
+				messenger.Warning("function not found : ", word)
+			}
+			return false
+		}
+		if where == "b" {
+			gemini.attach("function "+word+" from "+v.Buf.GetName(), functionHint(line, v.Buf.LinesNum(), v.Buf.Line))
+			break
+		}
+		if aiBlockedFile(where, symbolFiletype(where)) {
+			messenger.Warning(where, " is blocked by ai-blockfiles, not sent")
+			return false
+		}
+		data, err := os.ReadFile(where)
+		if err != nil {
+			messenger.Error(err.Error())
+			return false
+		}
+		lines := strings.Split(string(data), "\n")
+		gemini.attach("function "+word+" from "+filepath.Base(where), functionHint(line, len(lines), func(i int) string { return lines[i] }))
+	default:
+		messenger.Warning("Attach what? selection, buffer or function")
+		return false
+	}
+	return true
+}
+
+// GeminiHistory list the saved conversations, or reopen one of them
+func GeminiHistory(args []string) {
+	if len(args) == 0 {
+		var sb strings.Builder
+		for _, name := range geminiChatNames() {
+			chat, err := loadGeminiChat(name)
+			if err != nil {
+				continue
+			}
+			sb.WriteString(name + "  " + chat.Title + "\n")
+		}
+		if sb.Len() == 0 {
+			messenger.Information("No saved conversations")
+			return
+		}
+		CurView().OpenHelperView("h", "", "Reopen with > gemini:history <name>\n\n"+sb.String())
+		return
+	}
+	if !geminiReady() {
+		return
+	}
+	gemini.open(args[0])
+}
+
 // SaveAs saves the buffer with a new name
 func SaveAs(args []string) {
 	if len(args) > 0 && args[0] != "" {
@@ -205,6 +330,57 @@ func GroupGemini(args []string) {
 		if len(args) > 1 {
 			GeminiAskBuffer(args[1:])
 		}
+	case "new":
+		if geminiReady() {
+			if gemini.busy {
+				messenger.Warning(aiName(), " is still generating, cancel it first (Esc)")
+				return
+			}
+			gemini.newChat()
+			if len(args) > 1 {
+				GeminiAsk(args[1:])
+			} else {
+				messenger.Information("Next question starts a new conversation")
+			}
+		}
+	case "attach":
+		if len(args) > 1 {
+			GeminiAttach(args[1:])
+		}
+	case "edit":
+		GeminiEdit(args[1:])
+	case "history":
+		GeminiHistory(args[1:])
+	case "cancel":
+		if !GeminiCancel() {
+			messenger.Information(aiName(), " is not generating")
+		}
+	}
+}
+
+// GroupSearch execute search option
+func GroupSearch(args []string) {
+	switch args[0] {
+	case "grep":
+		if len(args) > 1 {
+			SearchGrep(strings.Join(args[1:], " "))
+		} else {
+			messenger.Warning("What to search?")
+		}
+	case "references":
+		CurView().FindReferences(false)
+	case "rename":
+		if len(args) == 2 {
+			CurView().renameSymbol(CurView().cursorWord(), args[1])
+		} else {
+			CurView().RenameSymbol(false)
+		}
+	case "replace":
+		if len(args) == 3 {
+			ProjectReplace(args[1], args[2])
+		} else {
+			messenger.Warning("Usage: search:replace <regex> <replacement>, quote them if they have spaces")
+		}
 	}
 }
 
@@ -226,20 +402,49 @@ func GroupConfig(args []string) {
 
 // GroupShow execute selected option
 func GroupShow(args []string) {
-	if args[0] == "snippets" {
+	switch args[0] {
+	case "snippets":
 		ShowSnippets()
+	case "undotree":
+		ShowUndoTree()
 	}
 }
 
 // GroupGit execute selected option
 func GroupGit(args []string) {
 	switch args[0] {
+	case "blame":
+		GitBlame()
+	case "branch":
+		GitBranch()
+	case "commit":
+		GitCommit(len(args) > 1 && args[1] == "amend")
 	case "diff":
 		GitDiff("")
 	case "diffstaged":
 		GitDiff("--staged")
+	case "diffsplit":
+		rev := ""
+		if len(args) > 1 {
+			rev = args[1]
+		}
+		GitSideDiff(rev)
+	case "filelog":
+		GitLog(true)
+	case "log":
+		GitLog(false)
+	case "show":
+		GitShowFile(args[1:])
 	case "status":
 		GitStatus()
+	case "stage":
+		CurView().StageHunk(false)
+	case "stash":
+		GitStash()
+	case "unstage":
+		CurView().UnstageHunk(false)
+	case "revert":
+		CurView().RevertHunk(false)
 	}
 }
 
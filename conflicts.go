@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// Merge conflicts, the regions between <<<<<<< and >>>>>>> markers are highlighted and resolved
+// by keeping our side, their side or both. With -mergetool mi-ide exits with an error while a file
+// given in the command line still has conflicts, so `git mergetool` can trust its exit code
+
+// conflict are the lines of the markers of a conflict region, base is -1 without a base section
+type conflict struct {
+	start int // <<<<<<<
+	base  int // |||||||
+	sep   int // =======
+	end   int // >>>>>>>
+}
+
+// conflictMarker checks if the line is the marker, followed by nothing or a space
+func conflictMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// findConflicts returns the complete conflict regions of the lines
+func findConflicts(lines func(int) string, n int) []conflict {
+	var conflicts []conflict
+	c := conflict{start: -1, base: -1, sep: -1}
+	for i := range n {
+		l := lines(i)
+		switch {
+		case conflictMarker(l, "<<<<<<<"):
+			c = conflict{start: i, base: -1, sep: -1}
+		case c.start < 0:
+		case conflictMarker(l, "|||||||") && c.sep < 0:
+			c.base = i
+		case l == "=======" && c.sep < 0:
+			c.sep = i
+		case conflictMarker(l, ">>>>>>>") && c.sep >= 0:
+			c.end = i
+			conflicts = append(conflicts, c)
+			c = conflict{start: -1, base: -1, sep: -1}
+		}
+	}
+	return conflicts
+}
+
+// UpdateConflicts finds the conflict regions of the buffer
+func (b *Buffer) UpdateConflicts() {
+	b.conflicts = findConflicts(b.Line, b.LinesNum())
+}
+
+// conflictAt returns the conflict that contains the line
+func (b *Buffer) conflictAt(line int) (conflict, bool) {
+	for _, c := range b.conflicts {
+		if line >= c.start && line <= c.end {
+			return c, true
+		}
+	}
+	return conflict{}, false
+}
+
+// conflictBackground returns the background of the line if it is part of a conflict
+func (b *Buffer) conflictBackground(line int) (tcell.Color, bool) {
+	c, ok := b.conflictAt(line)
+	if !ok {
+		return 0, false
+	}
+	var name, color string
+	switch {
+	case line == c.start || line == c.base || line == c.sep || line == c.end:
+		name, color = "conflict-marker", "#5f0000"
+	case line < c.sep && (c.base < 0 || line < c.base):
+		name, color = "conflict-ours", "#005f00"
+	case line < c.sep:
+		name, color = "conflict-base", "#3a3a3a"
+	default:
+		name, color = "conflict-theirs", "#00005f"
+	}
+	style := StringToStyle(color)
+	if s, ok := colorscheme[name]; ok {
+		style = s
+	}
+	fg, _, _ := style.Decompose()
+	return fg, true
+}
+
+// : Resolution
+
+// resolveConflict replaces the conflict under the cursor with the sections selected
+func (v *View) resolveConflict(ours, theirs bool) bool {
+	if v.Type.Readonly || v.Buf.RO {
+		messenger.Warning("File is read only")
+		return false
+	}
+	b := v.Buf
+	b.UpdateConflicts()
+	c, ok := b.conflictAt(v.Cursor.Y)
+	if !ok {
+		messenger.Information("No conflict under the cursor")
+		return false
+	}
+	oursEnd := c.sep
+	if c.base >= 0 {
+		oursEnd = c.base
+	}
+	var lines []string
+	if ours {
+		for l := c.start + 1; l < oursEnd; l++ {
+			lines = append(lines, b.Line(l))
+		}
+	}
+	if theirs {
+		for l := c.sep + 1; l < c.end; l++ {
+			lines = append(lines, b.Line(l))
+		}
+	}
+	v.Cursor.ResetSelection()
+	b.replaceLines(c.start, c.end+1, lines)
+	v.Cursor.GotoLoc(Loc{0, min(c.start, b.LinesNum()-1)})
+	v.Relocate()
+	b.UpdateConflicts()
+	if n := len(b.conflicts); n > 0 {
+		messenger.Information("Conflict resolved, ", n, " remaining")
+	} else {
+		messenger.Success("All conflicts resolved")
+	}
+	return true
+}
+
+// AcceptOurs keeps our side of the conflict under the cursor
+func (v *View) AcceptOurs(usePlugin bool) bool {
+	return v.resolveConflict(true, false)
+}
+
+// AcceptTheirs keeps their side of the conflict under the cursor
+func (v *View) AcceptTheirs(usePlugin bool) bool {
+	return v.resolveConflict(false, true)
+}
+
+// AcceptBoth keeps our side followed by their side of the conflict under the cursor
+func (v *View) AcceptBoth(usePlugin bool) bool {
+	return v.resolveConflict(true, true)
+}
+
+// NextConflict moves the cursor to the next conflict of the file
+func (v *View) NextConflict(usePlugin bool) bool {
+	v.Buf.UpdateConflicts()
+	if len(v.Buf.conflicts) == 0 {
+		messenger.Information("No conflicts")
+		return false
+	}
+	n := 0
+	for i, c := range v.Buf.conflicts {
+		if c.start > v.Cursor.Y {
+			n = i
+			break
+		}
+	}
+	v.Cursor.ResetSelection()
+	v.Cursor.GotoLoc(Loc{0, v.Buf.conflicts[n].start})
+	v.Relocate()
+	v.Center(false)
+	messenger.Information("Conflict ", n+1, " of ", len(v.Buf.conflicts))
+	return true
+}
+
+// : Mergetool
+
+// mergetoolStatus is the exit status for git mergetool, 1 while a file of the command line has conflicts
+func mergetoolStatus(files []string) int {
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(data), "\n")
+		if len(findConflicts(func(i int) string { return strings.TrimSuffix(lines[i], "\r") }, len(lines))) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
@@ -400,7 +400,7 @@ func (c *Cursor) GetCharPosInLine(lineNum, visualPos int) int {
 // GetCursorXFromVisual find the buffer X cursor location based on the visual location
 func (c *Cursor) GetCursorXFromVisual(lineNum, tabsize, lastx int) int {
 	x := 0
-	lineb := c.buf.lines[lineNum].data
+	lineb := c.buf.LineBytes(lineNum)
 	for i, r := range lineb {
 		if r == 9 {
 			x = x + tabsize
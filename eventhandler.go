@@ -55,12 +55,16 @@ func ExecuteTextEvent(t *TextEvent, buf *Buffer) {
 			t.Deltas[i].Text = buf.remove(d.Start, d.End)
 			buf.insert(d.Start, []byte(d.Text))
 			t.Deltas[i].Start = d.Start
-			t.Deltas[i].End = Loc{d.Start.X + Count(d.Text), d.Start.Y}
+			t.Deltas[i].End = d.Start.Move(Count(d.Text), buf)
 		}
 		for i, j := 0, len(t.Deltas)-1; i < j; i, j = i+1, j-1 {
 			t.Deltas[i], t.Deltas[j] = t.Deltas[j], t.Deltas[i]
 		}
 	}
+	if buf.conflicts != nil {
+		// Follow the edits of the conflict regions until all are resolved
+		buf.UpdateConflicts()
+	}
 }
 
 // UndoTextEvent undoes a text event
@@ -74,16 +78,14 @@ func UndoTextEvent(t *TextEvent, buf *Buffer) {
 
 // EventHandler executes text manipulations and allows undoing and redoing
 type EventHandler struct {
-	buf       *Buffer
-	UndoStack *Stack
-	RedoStack *Stack
+	buf      *Buffer
+	UndoTree *UndoTree
 }
 
 // NewEventHandler returns a new EventHandler
 func NewEventHandler(buf *Buffer) *EventHandler {
 	eh := new(EventHandler)
-	eh.UndoStack = new(Stack)
-	eh.RedoStack = new(Stack)
+	eh.UndoTree = NewUndoTree()
 	eh.buf = buf
 	return eh
 }
@@ -192,13 +194,9 @@ func (eh *EventHandler) Replace(start, end Loc, replace string) {
 	eh.Insert(start, replace)
 }
 
-// Execute a textevent and add it to the undo stack
+// Execute a textevent and add it to the undo tree
 func (eh *EventHandler) Execute(t *TextEvent) {
-	if eh.RedoStack.Len() > 0 {
-		eh.RedoStack = new(Stack)
-	}
-
-	eh.UndoStack.Push(t)
+	eh.UndoTree.Add(t)
 
 	// Execute Snippet Event Handler
 
@@ -222,12 +220,12 @@ func (eh *EventHandler) Execute(t *TextEvent) {
 	ExecuteTextEvent(t, eh.buf)
 }
 
-// Undo the first event in the undo stack
+// Undo the last group of events of the current branch
 func (eh *EventHandler) Undo() {
 	if currentSnippet != nil {
 		return
 	}
-	t := eh.UndoStack.Peek()
+	t := eh.UndoTree.Undoable()
 	if t == nil {
 		return
 	}
@@ -237,7 +235,7 @@ func (eh *EventHandler) Undo() {
 	eh.UndoOneEvent()
 
 	for {
-		t = eh.UndoStack.Peek()
+		t = eh.UndoTree.Undoable()
 		if t == nil {
 			return
 		}
@@ -251,16 +249,18 @@ func (eh *EventHandler) Undo() {
 	}
 }
 
-// UndoOneEvent undoes one event
+// UndoOneEvent undoes one event, moving to the parent state
 func (eh *EventHandler) UndoOneEvent() {
-	// This event should be undone
-	// Pop it off the stack
-	t := eh.UndoStack.Pop()
+	t := eh.UndoTree.up()
 	if t == nil {
 		return
 	}
-	// Undo it
-	// Modifies the text event
+	eh.revert(t)
+}
+
+// revert undoes or redoes the event, an undone event is reverted again to redo it
+// The event is modified, and its cursor swapped with the cursor of the buffer
+func (eh *EventHandler) revert(t *TextEvent) {
 	UndoTextEvent(t, eh.buf)
 
 	// Set the cursor in the right place
@@ -271,19 +271,14 @@ func (eh *EventHandler) UndoOneEvent() {
 	} else {
 		teCursor.Num = -1
 	}
-
-	// Push it to the redo stack
-	eh.RedoStack.Push(t)
-
-	// Check las saved stack length since open to see if we have the las clean state
 }
 
-// Redo the first event in the redo stack
+// Redo the next group of events of the current branch
 func (eh *EventHandler) Redo() {
 	if currentSnippet != nil {
 		return
 	}
-	t := eh.RedoStack.Peek()
+	t := eh.UndoTree.Redoable()
 	if t == nil {
 		return
 	}
@@ -293,7 +288,7 @@ func (eh *EventHandler) Redo() {
 	eh.RedoOneEvent()
 
 	for {
-		t = eh.RedoStack.Peek()
+		t = eh.UndoTree.Redoable()
 		if t == nil {
 			return
 		}
@@ -306,26 +301,33 @@ func (eh *EventHandler) Redo() {
 	}
 }
 
-// RedoOneEvent redoes one event
+// RedoOneEvent redoes one event, moving to the child state followed by redo
 func (eh *EventHandler) RedoOneEvent() {
-	if currentSnippet != nil {
-		return
-	}
-	t := eh.RedoStack.Pop()
+	t := eh.UndoTree.down()
 	if t == nil {
 		return
 	}
+	eh.revert(t)
+}
 
-	// Modifies the text event
-	UndoTextEvent(t, eh.buf)
-
-	teCursor := t.C
-	if teCursor.Num >= 0 && teCursor.Num < len(eh.buf.cursors) {
-		t.C = *eh.buf.cursors[teCursor.Num]
-		eh.buf.cursors[teCursor.Num].Goto(teCursor)
-	} else {
-		teCursor.Num = -1
+// UndoJump moves the buffer to any state of the undo tree, reverting the changes up to the
+// state shared by both branches, then applying the changes down to the state
+func (eh *EventHandler) UndoJump(n *undoNode) {
+	if currentSnippet != nil {
+		return
+	}
+	target := make(map[*undoNode]bool)
+	target[eh.UndoTree.root] = true
+	for _, p := range n.path() {
+		target[p] = true
+	}
+	for !target[eh.UndoTree.current] {
+		eh.UndoOneEvent()
+	}
+	for _, p := range n.path() {
+		if p.parent == eh.UndoTree.current {
+			p.parent.redo = p.index()
+			eh.RedoOneEvent()
+		}
 	}
-
-	eh.UndoStack.Push(t)
 }
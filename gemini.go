@@ -1,57 +1,390 @@
 package main
 
 import (
-	"context"
-
-	"google.golang.org/genai"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
+// geminiChat is a conversation, saved in configDir/buffers so it can be reopened with gemini:history
+type geminiChat struct {
+	Name     string      `json:"name"`
+	Title    string      `json:"title"`
+	Messages []aiMessage `json:"messages"`
+}
+
+// geminiEdit is a selection waiting for the code returned by gemini:edit
+type geminiEdit struct {
+	buf      *Buffer
+	start    Loc
+	end      Loc
+	original string
+	// values masked in the text sent
+	secrets []string
+}
+
+// geminiAttachment is context that will be sent with the next question
+type geminiAttachment struct {
+	label string
+	text  string
+	// secrets masked in text
+	redacted int
+}
+
 type geminiConnect struct {
-	client *genai.Client
+	provider aiProvider
+	// conversation in progress
+	chat *geminiChat
+	// context waiting for the next question
+	attachments []geminiAttachment
+	// buffer showing the conversation
+	buf *Buffer
+	// a question is being answered
+	busy bool
+	// the user aborted the answer in progress
+	canceled bool
+	// selection being edited
+	pending *geminiEdit
 }
 
+// GenaiNew create a connection with the ai provider configured in settings
 func GenaiNew() *geminiConnect {
-	g := &geminiConnect{client: nil}
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		messenger.AddLog(err.Error())
+	g := new(geminiConnect)
+	if !g.connect() {
 		return nil
 	}
-	g.client = client
 	return g
 }
 
-func (g *geminiConnect) ask(question string) {
-	messenger.Alert("info", "Asking Gemini, task will be sent to background ...")
+// connect creates the provider from the settings, again after an ai-* option changes
+// The conversation and the attachments are kept
+func (g *geminiConnect) connect() bool {
+	provider, err := newAIProvider(aiConfigFromSettings())
+	if err != nil {
+		messenger.AddLog(err.Error())
+		return false
+	}
+	g.provider = provider
+	return true
+}
+
+// : Chat files
+
+func geminiChatPath(name string) string {
+	return configDir + "/buffers/gemini-" + name + ".chat"
+}
+
+// geminiChatNames list the saved conversations, newest first
+func geminiChatNames() []string {
+	var names []string
+	files, err := os.ReadDir(configDir + "/buffers")
+	if err != nil {
+		return names
+	}
+	for _, f := range files {
+		name, ok := strings.CutPrefix(f.Name(), "gemini-")
+		if ok && strings.HasSuffix(name, ".chat") {
+			names = append(names, strings.TrimSuffix(name, ".chat"))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names
+}
+
+func loadGeminiChat(name string) (*geminiChat, error) {
+	data, err := os.ReadFile(geminiChatPath(name))
+	if err != nil {
+		return nil, err
+	}
+	chat := new(geminiChat)
+	if err := json.Unmarshal(data, chat); err != nil {
+		return nil, err
+	}
+	chat.Name = name
+	return chat, nil
+}
+
+func (c *geminiChat) save() error {
+	data, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(geminiChatPath(c.Name), data, 0644)
+}
+
+// render the conversation as shown in the chat buffer
+func (c *geminiChat) render() string {
+	var sb strings.Builder
+	for _, m := range c.Messages {
+		sb.WriteString(geminiHeader(m.Role))
+		sb.WriteString(m.Content)
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+func geminiHeader(role string) string {
+	if role == "user" {
+		return "## You\n"
+	}
+	return "## " + aiName() + "\n"
+}
+
+// : Chat view
+
+// chatView returns the tab and view showing the conversation, nil if it was closed
+func (g *geminiConnect) chatView() (int, *View) {
+	if g.buf == nil {
+		return 0, nil
+	}
+	for i, t := range tabs {
+		for _, v := range t.Views {
+			if v.Buf == g.buf {
+				return i, v
+			}
+		}
+	}
+	return 0, nil
+}
+
+// showChat focus the conversation view, or open it in a new tab
+func (g *geminiConnect) showChat() {
+	if i, v := g.chatView(); v != nil {
+		curTab = i
+		tabs[i].CurView = v.Num
+		navigationMode = true
+		return
+	}
+	CurView().AddTab(false)
+	CurView().Buf = NewBufferFromString(g.chat.render(), "")
+	CurView().Buf.Settings["filetype"] = "gemini"
+	CurView().Type = vtLog
+	CurView().Buf.UpdateRules()
+	CurView().Buf.Fname = "gemini"
+	SetLocalOption("ruler", "false", CurView())
+	SetLocalOption("softwrap", "true", CurView())
+	CurView().Buf.Cursor.Loc = CurView().Buf.End()
+	CurView().Buf.Cursor.Relocate()
+	navigationMode = true
+	g.buf = CurView().Buf
+}
+
+// attach context to the next question, secrets are masked before
+func (g *geminiConnect) attach(label, text string) {
+	text, secrets := AIRedact(text)
+	g.attachments = append(g.attachments, geminiAttachment{label, text, len(secrets)})
+	msg := fmt.Sprint("Attached ", label, " to the next question (", len(g.attachments), " attachments)")
+	if len(secrets) > 0 {
+		msg += fmt.Sprint(", ", len(secrets), " secrets redacted")
+	}
+	messenger.Information(msg)
+}
+
+// newChat forget the conversation in progress, the next question opens a new tab
+func (g *geminiConnect) newChat() {
+	g.chat = nil
+	g.buf = nil
+	g.attachments = nil
+}
+
+// open a saved conversation to continue it
+func (g *geminiConnect) open(name string) {
+	if g.busy {
+		messenger.Warning(aiName(), " is still generating, cancel it first (Esc)")
+		return
+	}
+	chat, err := loadGeminiChat(name)
+	if err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	g.newChat()
+	g.chat = chat
+	g.showChat()
+}
+
+// ask sends a question, with the pending attachments, in the conversation and streams the answer
+// The answer is requested in the background, every chunk is sent through the jobs channel
+// so the buffer is only modified and drawn from the main loop. Returns false if the question was refused
+func (g *geminiConnect) ask(question string) bool {
+	if g.busy {
+		messenger.Warning(aiName(), " is still generating, cancel it first (Esc)")
+		return false
+	}
+	content := question
+	redacted := 0
+	for _, a := range g.attachments {
+		content += "\n\n" + a.label + ":\n```\n" + strings.TrimSuffix(a.text, "\n") + "\n```"
+		redacted += a.redacted
+	}
+	g.attachments = nil
+	if g.chat == nil {
+		g.chat = &geminiChat{Name: time.Now().Format("20060102-150405"), Title: question}
+		if title := []rune(question); len(title) > 60 {
+			g.chat.Title = string(title[:60])
+		}
+	}
+	g.showChat()
+	g.chat.Messages = append(g.chat.Messages, aiMessage{Role: "user", Content: content})
+	messages := append([]aiMessage(nil), g.chat.Messages...)
+	g.chat.Messages = append(g.chat.Messages, aiMessage{Role: "model"})
+	g.write(geminiHeader("user") + content + "\n\n" + geminiHeader("model"))
+	g.busy = true
+	g.canceled = false
+	if redacted > 0 {
+		messenger.Information("Asking ", aiName(), ", ", redacted, " secrets redacted, Esc to cancel ...")
+	} else {
+		messenger.Information("Asking ", aiName(), ", Esc to cancel ...")
+	}
 	go func() {
-		ctx := context.Background()
-		thinkingBudgetVal := int32(0)
-		result, err := g.client.Models.GenerateContent(
-			ctx,
-			"gemini-3-flash-preview",
-			genai.Text(question),
-			&genai.GenerateContentConfig{
-				ThinkingConfig: &genai.ThinkingConfig{
-					ThinkingBudget: &thinkingBudgetVal,
-				},
-			})
+		err := g.provider.stream(messages, func(chunk string) {
+			jobs <- JobFunction{g.addChunk, chunk, nil}
+		})
+		msg := ""
 		if err != nil {
-			messenger.Alert("warning", "Gemini error, check log")
-			messenger.AddLog(err)
-			gemini = nil
-			return
+			msg = err.Error()
 		}
-		CurView().AddTab(false)
-		CurView().Buf = NewBufferFromString(result.Text(), "")
-		CurView().Buf.Settings["filetype"] = "gemini"
-		CurView().Type = vtLog
-		CurView().Buf.UpdateRules()
-		CurView().Buf.Fname = "gemini"
-		SetLocalOption("ruler", "false", CurView())
-		SetLocalOption("softwrap", "true", CurView())
-		navigationMode = true
+		jobs <- JobFunction{g.finish, msg, nil}
+	}()
+	return true
+}
+
+// write appends text to the chat buffer, the view follows the text if the cursor was at the end
+func (g *geminiConnect) write(text string) {
+	b := g.buf
+	follow := b.Cursor.Loc == b.End()
+	b.insert(b.End(), []byte(text))
+	if follow {
+		b.Cursor.Loc = b.End()
+		b.Cursor.Relocate()
+	}
+	b.IsModified = false
+}
+
+// addChunk appends a piece of the answer, runs in the main loop
+func (g *geminiConnect) addChunk(chunk string, args ...string) {
+	g.chat.Messages[len(g.chat.Messages)-1].Content += chunk
+	g.write(chunk)
+}
+
+// finish the answer in progress and save the conversation, runs in the main loop
+func (g *geminiConnect) finish(msg string, args ...string) {
+	g.busy = false
+	g.write("\n\n")
+	if n := len(g.chat.Messages); g.chat.Messages[n-1].Content == "" {
+		// Nothing was answered, drop the question so the turns keep alternating
+		g.chat.Messages = g.chat.Messages[:n-2]
+	}
+	if len(g.chat.Messages) > 0 {
+		if err := g.chat.save(); err != nil {
+			messenger.AddLog(aiName(), ", could not save chat: ", err.Error())
+		}
+	}
+	switch {
+	case g.canceled:
+		messenger.Warning(aiName(), " canceled")
+	case msg == "":
 		messenger.ClearMessage()
-		RedrawAll(false)
+	default:
+		messenger.Alert("warning", aiName()+" error, check log")
+		messenger.AddLog(msg)
+	}
+}
+
+// : Edits
+
+var geminiCodeBlock = regexp.MustCompile("(?s)```[^\n]*\n(.*?)```")
+
+// edit asks gemini to change the selection following the instruction
+// The answer is shown as a diff, and applied as a single undoable event if the user accepts it
+func (g *geminiConnect) edit(v *View, instruction string) {
+	if g.busy {
+		messenger.Warning(aiName(), " is still generating, cancel it first (Esc)")
+		return
+	}
+	start, end := v.Cursor.CurSelection[0], v.Cursor.CurSelection[1]
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	g.pending = &geminiEdit{buf: v.Buf, start: start, end: end, original: v.Buf.Substr(start, end)}
+	code, secrets := AIRedact(g.pending.original)
+	g.pending.secrets = secrets
+	question := "Apply the following instruction to the " + v.Buf.FileType() + " code below: " + instruction + "\n" +
+		"Answer only with the complete modified code in a single fenced code block, without explanations.\n" +
+		"Keep the [REDACTED-n] placeholders unchanged.\n" +
+		"```\n" + code + "\n```"
+	g.busy = true
+	g.canceled = false
+	msg := aiName() + " is editing the selection, Esc to cancel ..."
+	if len(secrets) > 0 {
+		msg = fmt.Sprint(len(secrets), " secrets redacted. ", msg)
+	}
+	messenger.Information(msg)
+	go func() {
+		answer, err := g.provider.ask(question)
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		jobs <- JobFunction{g.finishEdit, answer, []string{msg}}
 	}()
 }
+
+// finishEdit shows the diff of the answer and applies it on accept, runs in the main loop
+func (g *geminiConnect) finishEdit(answer string, args ...string) {
+	g.busy = false
+	e := g.pending
+	g.pending = nil
+	if g.canceled {
+		messenger.Warning(aiName(), " canceled")
+		return
+	} else if args[0] != "" {
+		messenger.Alert("warning", aiName()+" error, check log")
+		messenger.AddLog(args[0])
+		return
+	}
+	code := answer
+	if m := geminiCodeBlock.FindStringSubmatch(answer); m != nil {
+		code = m[1]
+	}
+	code = AIRestore(code, e.secrets)
+	// Keep the line ending of the selection
+	code = strings.TrimRight(code, "\n")
+	if strings.HasSuffix(e.original, "\n") {
+		code += "\n"
+	}
+	if code == e.original {
+		messenger.Information(aiName(), " did not change the selection")
+		return
+	}
+	CurView().OpenHelperView("v", "git-diff", "--- selection\n+++ gemini\n"+LineDiff(e.original, code), 0.5)
+	RedrawAll(false)
+	apply, canceled := messenger.YesNoPrompt("Apply gemini edit? (y,n)")
+	CurView().CloseHelperView()
+	if !apply || canceled {
+		messenger.Information(aiName(), " edit discarded")
+		return
+	}
+	if e.buf.Substr(e.start, e.end) != e.original {
+		messenger.Warning("Selection changed while waiting for ", aiName(), ", edit discarded")
+		return
+	}
+	e.buf.MultipleReplace([]Delta{{code, e.start, e.end}})
+	e.buf.Cursor.ResetSelection()
+	e.buf.Cursor.GotoLoc(e.start)
+	messenger.Success(aiName(), " edit applied, undo to revert")
+}
+
+// GeminiCancel abort the answer in progress, returns false if there was nothing to cancel
+func GeminiCancel() bool {
+	if gemini == nil || !gemini.busy {
+		return false
+	}
+	gemini.canceled = true
+	gemini.provider.cancel()
+	return true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Branches and stashes, selected in a dialog. After a checkout, or applying a stash, the buffers
+// of the files changed on disk are reloaded, or flagged if they have unsaved changes
+
+// gitRun runs a git command in the working directory, an error has the first line of the output
+func gitRun(arg ...string) (string, bool) {
+	out, err := exec.Command("git", arg...).CombinedOutput()
+	if err != nil {
+		messenger.AddLog("git ", strings.Join(arg, " "), ":\n", string(out))
+		msg, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		messenger.Error("git ", arg[0], " failed: ", msg)
+		return string(out), false
+	}
+	return string(out), true
+}
+
+// dialogOption removes the characters that separate the options of a select
+func dialogOption(s string) string {
+	return strings.NewReplacer("|", "/", "]", ")").Replace(s)
+}
+
+// GitBranch opens the dialog to checkout or create a branch
+func GitBranch() {
+	if !git.enabled && !git.CheckGit() {
+		messenger.Warning("Not a git repository")
+		return
+	}
+	out, ok := gitRun("branch", "--format=%(refname:short)")
+	if !ok {
+		return
+	}
+	current, _ := gitRun("branch", "--show-current")
+	var options []string
+	for b := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		if b != "" {
+			options = append(options, dialogOption(b))
+		}
+	}
+	micromenu.GitBranchDialog(options, strings.TrimSpace(current), gitBranchAnswer)
+}
+
+// gitBranchAnswer checks out the branch selected, or creates the new one
+func gitBranchAnswer(values map[string]string) {
+	switch values["action"] {
+	case "create":
+		name := strings.TrimSpace(values["new"])
+		if name == "" {
+			messenger.Warning("Write the name of the new branch")
+			return
+		}
+		if _, ok := gitRun("checkout", "-b", name); !ok {
+			return
+		}
+		messenger.Success("Created branch ", name)
+	case "checkout":
+		if values["branch"] == "" {
+			return
+		}
+		if _, ok := gitRun("checkout", values["branch"]); !ok {
+			return
+		}
+		messenger.Success("Switched to branch ", values["branch"])
+	default:
+		return
+	}
+	gitWorkTreeChanged()
+}
+
+// GitStash opens the dialog to save the changes in a stash or restore one
+func GitStash() {
+	if !git.enabled && !git.CheckGit() {
+		messenger.Warning("Not a git repository")
+		return
+	}
+	out, ok := gitRun("stash", "list", "--format=%gd%x09%s")
+	if !ok {
+		return
+	}
+	var options []string
+	for l := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		if ref, msg, ok := strings.Cut(l, "\t"); ok {
+			options = append(options, ref+"]"+dialogOption(ref+"  "+msg))
+		}
+	}
+	micromenu.GitStashDialog(options, gitStashAnswer)
+}
+
+// gitStashAnswer runs the stash command of the button pressed
+func gitStashAnswer(values map[string]string) {
+	stash := values["stash"]
+	switch values["action"] {
+	case "push":
+		args := []string{"stash", "push"}
+		if msg := strings.TrimSpace(values["message"]); msg != "" {
+			args = append(args, "-m", msg)
+		}
+		if _, ok := gitRun(args...); !ok {
+			return
+		}
+		messenger.Success("Changes saved in the stash")
+	case "apply", "pop", "drop":
+		if stash == "" {
+			messenger.Warning("No stash selected")
+			return
+		}
+		if _, ok := gitRun("stash", values["action"], stash); !ok {
+			// a conflict leaves the stash applied with markers, the buffers have to be reloaded
+			gitWorkTreeChanged()
+			return
+		}
+		messenger.Success("git stash ", values["action"], " ", stash)
+		if values["action"] == "drop" {
+			git.GitSetStatus()
+			return
+		}
+	default:
+		return
+	}
+	gitWorkTreeChanged()
+}
+
+// gitWorkTreeChanged updates the status and the buffers after git changed the files
+func gitWorkTreeChanged() {
+	git.GitSetStatus()
+	if names := ReloadChangedBuffers(); len(names) > 0 {
+		messenger.Warning("Changed on disk with unsaved changes: ", strings.Join(names, ", "))
+	}
+	RefreshGitGutters()
+}
+
+// ReloadChangedBuffers reloads the buffers whose file changed on disk
+// Returns the names of the buffers not reloaded because they have unsaved changes,
+// their reload is asked when they are used again
+func ReloadChangedBuffers() []string {
+	var flagged []string
+	seen := make(map[*Buffer]bool)
+	for _, t := range tabs {
+		for _, v := range t.Views {
+			b := v.Buf
+			if seen[b] || v.Type != vtDefault || b.Path == "" {
+				continue
+			}
+			seen[b] = true
+			modTime, ok := GetModTime(b.Path)
+			if !ok || modTime == b.ModTime {
+				continue
+			}
+			if b.Modified() {
+				flagged = append(flagged, filepath.Base(b.Path))
+				continue
+			}
+			b.ReOpen()
+			v.Relocate()
+		}
+	}
+	return flagged
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Commit composer, the message is written in a buffer like git's own template, the commit is made
+// when the buffer is saved and closed. Closing it without saving cancels the commit
+
+// gitFileStatus are the words git uses in the commit template for each status letter
+var gitFileStatus = map[byte]string{
+	'A': "new file",
+	'C': "copied",
+	'D': "deleted",
+	'M': "modified",
+	'R': "renamed",
+	'T': "typechange",
+}
+
+// commitTemplate returns the comments listing the files to commit
+func commitTemplate(amend bool) (string, bool) {
+	args := []string{"diff", "--cached", "--name-status"}
+	if amend {
+		args = append(args, "HEAD^")
+	}
+	out, err := ExecCommand("git", args...)
+	if err != nil && amend {
+		// the first commit of the repository
+		out, err = ExecCommand("git", "diff", "--cached", "--name-status", "--root")
+	}
+	if err != nil {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString("\n# Please enter the commit message for your changes. Lines starting\n")
+	sb.WriteString("# with '#' will be ignored, and an empty message aborts the commit.\n")
+	sb.WriteString("# Save and close this buffer to commit, close it without saving to cancel.\n#\n")
+	sb.WriteString("# Changes to be committed:\n")
+	files := 0
+	for l := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(l, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		status, ok := gitFileStatus[fields[0][0]]
+		if !ok {
+			status = "changed"
+		}
+		file := fields[1]
+		if len(fields) > 2 {
+			file += " -> " + fields[2]
+		}
+		sb.WriteString("#\t" + status + ":" + strings.Repeat(" ", max(1, 11-len(status))) + file + "\n")
+		files++
+	}
+	sb.WriteString("#\n")
+	return sb.String(), files > 0
+}
+
+// GitCommit opens the commit message in a new tab, amend edits the last commit
+func GitCommit(amend bool) {
+	if !git.enabled && !git.CheckGit() {
+		messenger.Warning("Not a git repository")
+		return
+	}
+	template, staged := commitTemplate(amend)
+	if !staged && !amend {
+		messenger.Warning("Nothing staged to commit")
+		return
+	}
+	if amend {
+		last, err := ExecCommand("git", "log", "-1", "--format=%B")
+		if err != nil {
+			messenger.Warning("No commit to amend")
+			return
+		}
+		template = strings.TrimRight(last, "\n") + "\n" + template
+	}
+	out, err := ExecCommand("git", "rev-parse", "--git-path", "COMMIT_EDITMSG")
+	if err != nil {
+		messenger.Error("git rev-parse failed: ", strings.TrimSpace(out))
+		return
+	}
+	path, _ := filepath.Abs(strings.TrimSpace(out))
+	if err := os.WriteFile(path, []byte(template), 0644); err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	NewTab([]string{path})
+	v := CurView()
+	if v.Buf.AbsPath != path {
+		return
+	}
+	// only a message saved by the user is committed, closing without saving cancels
+	saved := false
+	v.onSave = func(*View) {
+		saved = true
+	}
+	v.onClose = func(v *View) {
+		gitCommitFile(path, amend, !saved || v.Buf.Modified())
+	}
+	if amend {
+		messenger.Information("Amend the last commit: save and close to commit, close without saving to cancel")
+	} else {
+		messenger.Information("Save and close to commit, close without saving to cancel")
+	}
+}
+
+// gitCommits are the commits running in the background, the editor waits for them before exiting
+var gitCommits sync.WaitGroup
+
+// gitCommitFile makes the commit with the message of the file in the background
+func gitCommitFile(path string, amend, canceled bool) {
+	if canceled {
+		messenger.Information("Commit canceled")
+		return
+	}
+	args := []string{"commit", "--cleanup=strip", "-F", path}
+	if amend {
+		args = append(args, "--amend")
+	}
+	messenger.Information("Committing ...")
+	gitCommits.Add(1)
+	go func() {
+		out, err := ExecCommand("git", args...)
+		gitCommits.Done()
+		jobs <- JobFunction{func(string, ...string) {
+			if err != nil {
+				messenger.AddLog("git commit:\n", out)
+				messenger.Error("git commit failed: ", strings.TrimSpace(out))
+				return
+			}
+			git.GitSetStatus()
+			RefreshGitGutters()
+			messenger.Success(strings.SplitN(strings.TrimSpace(out), "\n", 2)[0])
+		}, "", nil}
+	}()
+}
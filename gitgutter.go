@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hanspr/tcell/v2"
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Git gutter, the lines of a buffer that changed against its version in HEAD (or the index) are marked
+// next to the line numbers. The version in git is read in the background when the file is opened and
+// after git commands, the diff is computed again on every save
+
+// gitChange is the kind of change of a line
+type gitChange uint8
+
+const (
+	gitAdded gitChange = iota + 1
+	gitModified
+	// lines were deleted after this line
+	gitDeleted
+)
+
+// gitHunk is a block of consecutive changed lines
+type gitHunk struct {
+	start int // first line in the buffer, 0 based
+	end   int // line after the last one, equal to start for deleted lines
+	// first removed line in the git version, and the lines removed
+	oldStart int
+	old      []string
+	// lines added in the buffer, without line endings as old
+	new []string
+}
+
+// gitGutter holds the version of the file in git and the changes of the buffer against it
+type gitGutter struct {
+	base  string
+	hunks []gitHunk
+	lines map[int]gitChange
+}
+
+// gitBaseRef is the revision compared, "" compares against the index
+func gitBaseRef() string {
+	if globalSettings["git-gutterbase"].(string) == "index" {
+		return ""
+	}
+	return "HEAD"
+}
+
+// readGitFile returns the content of the file in the revision, "" reads the index
+// Returns false if the file is not tracked
+func readGitFile(path, ref string) (string, bool) {
+	cmd := exec.Command("git", "-C", filepath.Dir(path), "show", ref+":./"+filepath.Base(path))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// UpdateGitBase reads again in the background the git version of the buffer and updates its markers
+func (b *Buffer) UpdateGitBase() {
+	if !globalSettings["git-gutter"].(bool) || b.Path == "" || !git.enabled {
+		b.gitDiff = nil
+		return
+	}
+	path, _ := filepath.Abs(b.Path)
+	go func() {
+		base, ok := readGitFile(path, gitBaseRef())
+		jobs <- JobFunction{func(string, ...string) {
+			if !ok {
+				b.gitDiff = nil
+				return
+			}
+			b.gitDiff = &gitGutter{base: base}
+			b.UpdateGitGutter()
+		}, "", nil}
+	}()
+}
+
+// UpdateGitGutter computes the changes of the buffer against the git version read before
+func (b *Buffer) UpdateGitGutter() {
+	if b.gitDiff == nil {
+		return
+	}
+	g := b.gitDiff
+	g.hunks = diffHunks(g.base, b.String())
+	g.lines = make(map[int]gitChange)
+	for _, h := range g.hunks {
+		switch {
+		case len(h.new) == 0:
+			g.lines[max(h.start-1, 0)] = gitDeleted
+		case len(h.old) == 0:
+			for l := h.start; l < h.end; l++ {
+				g.lines[l] = gitAdded
+			}
+		default:
+			for l := h.start; l < h.end; l++ {
+				g.lines[l] = gitModified
+			}
+		}
+	}
+}
+
+// diffHunks returns the blocks of lines that changed from old to new
+func diffHunks(old, new string) []gitHunk {
+	var hunks []gitHunk
+	differ := dmp.New()
+	ca, cb, lines := differ.DiffLinesToChars(old, new)
+	diffs := differ.DiffCharsToLines(differ.DiffMain(ca, cb, false), lines)
+	splitLines := func(text string) []string {
+		return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	newLine, oldLine := 0, 0
+	for i := 0; i < len(diffs); i++ {
+		d := diffs[i]
+		if d.Type == dmp.DiffEqual {
+			n := len(splitLines(d.Text))
+			newLine += n
+			oldLine += n
+			continue
+		}
+		h := gitHunk{start: newLine, end: newLine, oldStart: oldLine}
+		if d.Type == dmp.DiffDelete {
+			h.old = splitLines(d.Text)
+			oldLine += len(h.old)
+			if i+1 < len(diffs) && diffs[i+1].Type == dmp.DiffInsert {
+				i++
+				d = diffs[i]
+			}
+		}
+		if d.Type == dmp.DiffInsert {
+			h.new = splitLines(d.Text)
+			h.end = h.start + len(h.new)
+			newLine = h.end
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// RefreshGitGutters reads again the git version of every open buffer, used after git commands
+func RefreshGitGutters() {
+	for _, t := range tabs {
+		for _, v := range t.Views {
+			if v.Type == vtDefault {
+				v.Buf.UpdateGitBase()
+			}
+		}
+	}
+}
+
+// gitMarker returns the marker of the line and its style, 0 if the line did not change
+func (b *Buffer) gitMarker(line int, style tcell.Style) (rune, tcell.Style) {
+	if b.gitDiff == nil {
+		return 0, style
+	}
+	var name, color string
+	var marker rune
+	switch b.gitDiff.lines[line] {
+	case gitAdded:
+		name, color, marker = "diff-added", "#00AF00", '▎'
+	case gitModified:
+		name, color, marker = "diff-modified", "#FFAF00", '▎'
+	case gitDeleted:
+		name, color, marker = "diff-deleted", "#D70000", '▁'
+	default:
+		return 0, style
+	}
+	fg := StringToStyle(color)
+	if s, ok := colorscheme[name]; ok {
+		fg = s
+	}
+	c, _, _ := fg.Decompose()
+	return marker, style.Foreground(c)
+}
+
+// : Navigation
+
+// gitHunkStarts returns the first line of each hunk
+func (b *Buffer) gitHunkStarts() []int {
+	var starts []int
+	if b.gitDiff == nil {
+		return starts
+	}
+	for _, h := range b.gitDiff.hunks {
+		if len(h.new) == 0 {
+			starts = append(starts, max(h.start-1, 0))
+		} else {
+			starts = append(starts, h.start)
+		}
+	}
+	sort.Ints(starts)
+	return starts
+}
+
+// changeStarts returns the first line of each change of a side by side diff, or of the git changes
+func (v *View) changeStarts() []int {
+	if v.diff != nil {
+		return v.diff.starts
+	}
+	return v.Buf.gitHunkStarts()
+}
+
+// NextHunk moves the cursor to the next block of lines changed since the git version
+func (v *View) NextHunk(usePlugin bool) bool {
+	starts := v.changeStarts()
+	if len(starts) == 0 {
+		messenger.Information("No changes")
+		return false
+	}
+	line := starts[0]
+	for _, s := range starts {
+		if s > v.Cursor.Y {
+			line = s
+			break
+		}
+	}
+	v.gotoHunk(line, starts)
+	return true
+}
+
+// PreviousHunk moves the cursor to the previous block of lines changed since the git version
+func (v *View) PreviousHunk(usePlugin bool) bool {
+	starts := v.changeStarts()
+	if len(starts) == 0 {
+		messenger.Information("No changes")
+		return false
+	}
+	line := starts[len(starts)-1]
+	for i := len(starts) - 1; i >= 0; i-- {
+		if starts[i] < v.Cursor.Y {
+			line = starts[i]
+			break
+		}
+	}
+	v.gotoHunk(line, starts)
+	return true
+}
+
+func (v *View) gotoHunk(line int, starts []int) {
+	v.Cursor.ResetSelection()
+	v.Cursor.GotoLoc(Loc{0, min(line, v.Buf.LinesNum()-1)})
+	v.Relocate()
+	v.Center(false)
+	n := sort.SearchInts(starts, line)
+	messenger.Information("Change ", n+1, " of ", len(starts))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Hunk actions, the block of changed lines under the cursor is staged or unstaged by generating
+// a patch without context for `git apply --cached`, or reverted in the buffer to its git version
+
+// hunkAt returns the hunk that contains the line, deleted lines belong to the line before them
+func hunkAt(hunks []gitHunk, line int) (gitHunk, bool) {
+	for _, h := range hunks {
+		if (line >= h.start && line < h.end) || (len(h.new) == 0 && line == max(h.start-1, 0)) {
+			return h, true
+		}
+	}
+	return gitHunk{}, false
+}
+
+// hunkRange returns the range of a side of the hunk as written in a unified diff
+// An empty range starts at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// hunkPatch returns a patch of the hunk for the file rel of the repository
+// oldEOL and newEOL tell if each version of the file ends with a new line
+func hunkPatch(rel string, h gitHunk, oldLines, newLines int, oldEOL, newEOL bool) string {
+	var sb strings.Builder
+	sb.WriteString("diff --git a/" + rel + " b/" + rel + "\n")
+	sb.WriteString("--- a/" + rel + "\n+++ b/" + rel + "\n")
+	sb.WriteString("@@ -" + hunkRange(h.oldStart, len(h.old)) + " +" + hunkRange(h.start, len(h.new)) + " @@\n")
+	for i, l := range h.old {
+		sb.WriteString("-" + l + "\n")
+		if !oldEOL && h.oldStart+i == oldLines-1 {
+			sb.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	for i, l := range h.new {
+		sb.WriteString("+" + l + "\n")
+		if !newEOL && h.start+i == newLines-1 {
+			sb.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+// countLines returns the number of lines of text and if it ends with a new line
+func countLines(text string) (int, bool) {
+	if text == "" {
+		return 0, true
+	}
+	eol := strings.HasSuffix(text, "\n")
+	return len(strings.Split(strings.TrimSuffix(text, "\n"), "\n")), eol
+}
+
+// gitRepoPath returns the root of the repository of path and the path relative to it
+func gitRepoPath(path string) (string, string, error) {
+	out, err := exec.Command("git", "-C", filepath.Dir(path), "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not in a git repository", filepath.Base(path))
+	}
+	root := strings.TrimSpace(string(out))
+	// the toplevel is reported with symlinks resolved
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", "", err
+	}
+	return root, filepath.ToSlash(rel), nil
+}
+
+// gitApplyCached applies the patch to the index, reverse undoes a patch already applied
+func gitApplyCached(root, patch string, reverse bool) error {
+	args := []string{"-C", root, "apply", "--cached", "--unidiff-zero"}
+	if reverse {
+		args = append(args, "-R")
+	}
+	cmd := exec.Command("git", append(args, "-")...)
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		messenger.AddLog("git apply:\n", patch, string(out))
+		return fmt.Errorf("git apply failed, check log")
+	}
+	return nil
+}
+
+// gitHunkFile checks the buffer can be used by the hunk actions and returns its absolute path
+func gitHunkFile(v *View) (string, bool) {
+	if v.Type != vtDefault || v.Buf.Path == "" {
+		messenger.Warning("Hunk actions only work on files")
+		return "", false
+	}
+	if !git.enabled && !git.CheckGit() {
+		messenger.Warning("Not a git repository")
+		return "", false
+	}
+	path, _ := filepath.Abs(v.Buf.Path)
+	return path, true
+}
+
+// StageHunk adds to the index the changes of the buffer under the cursor
+func (v *View) StageHunk(usePlugin bool) bool {
+	path, ok := gitHunkFile(v)
+	if !ok {
+		return false
+	}
+	index, ok := readGitFile(path, "")
+	if !ok {
+		messenger.Warning("File is not tracked, add it first")
+		return false
+	}
+	text := v.Buf.String()
+	h, ok := hunkAt(diffHunks(index, text), v.Cursor.Y)
+	if !ok {
+		messenger.Information("No unstaged change under the cursor")
+		return false
+	}
+	root, rel, err := gitRepoPath(path)
+	if err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	oldLines, oldEOL := countLines(index)
+	newLines, newEOL := countLines(text)
+	if err := gitApplyCached(root, hunkPatch(rel, h, oldLines, newLines, oldEOL, newEOL), false); err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	git.GitSetStatus()
+	RefreshGitGutters()
+	messenger.Success("Hunk staged")
+	return true
+}
+
+// UnstageHunk removes from the index the staged changes of the lines under the cursor
+func (v *View) UnstageHunk(usePlugin bool) bool {
+	path, ok := gitHunkFile(v)
+	if !ok {
+		return false
+	}
+	index, ok := readGitFile(path, "")
+	if !ok {
+		messenger.Warning("File is not tracked")
+		return false
+	}
+	head, _ := readGitFile(path, "HEAD")
+	// the line under the cursor in the index version
+	line := v.Cursor.Y
+	for _, h := range diffHunks(index, v.Buf.String()) {
+		if h.start > v.Cursor.Y {
+			break
+		}
+		if v.Cursor.Y < h.end {
+			line = h.oldStart
+			break
+		}
+		line += len(h.old) - len(h.new)
+	}
+	h, ok := hunkAt(diffHunks(head, index), line)
+	if !ok {
+		messenger.Information("No staged change under the cursor")
+		return false
+	}
+	root, rel, err := gitRepoPath(path)
+	if err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	oldLines, oldEOL := countLines(head)
+	newLines, newEOL := countLines(index)
+	if err := gitApplyCached(root, hunkPatch(rel, h, oldLines, newLines, oldEOL, newEOL), true); err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	git.GitSetStatus()
+	RefreshGitGutters()
+	messenger.Success("Hunk unstaged")
+	return true
+}
+
+// replaceLines replaces the lines from start to end, not included, with lines as a single undo event
+func (b *Buffer) replaceLines(start, end int, lines []string) {
+	from, to := Loc{0, start}, Loc{0, end}
+	text := ""
+	for _, l := range lines {
+		text += l + "\n"
+	}
+	if end >= b.LinesNum() {
+		// the lines reach the end of a file without a new line at the end
+		to = b.End()
+		text = strings.TrimSuffix(text, "\n")
+		if start > 0 {
+			from = Loc{Count(b.Line(start - 1)), start - 1}
+			if text != "" {
+				text = "\n" + text
+			}
+		}
+	}
+	b.MultipleReplace([]Delta{{text, from, to}})
+}
+
+// RevertHunk replaces the changed lines under the cursor with their git version, undo restores them
+func (v *View) RevertHunk(usePlugin bool) bool {
+	if _, ok := gitHunkFile(v); !ok {
+		return false
+	}
+	if v.Buf.RO {
+		messenger.Warning("File is read only")
+		return false
+	}
+	b := v.Buf
+	if b.gitDiff == nil {
+		messenger.Information("No git version of the file")
+		return false
+	}
+	b.UpdateGitGutter()
+	h, ok := hunkAt(b.gitDiff.hunks, v.Cursor.Y)
+	if !ok {
+		messenger.Information("No change under the cursor")
+		return false
+	}
+	v.Cursor.ResetSelection()
+	b.replaceLines(h.start, h.end, h.old)
+	v.Cursor.GotoLoc(Loc{0, min(h.start, b.LinesNum()-1)})
+	v.Relocate()
+	b.UpdateGitGutter()
+	messenger.Success("Hunk reverted, undo to restore it")
+	return true
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// Git log browser, the history of the repository or of a file in a list
+// Enter shows the diff of the commit under the cursor, o opens the file as it was in that commit
+// with git:show, the file of the log or, in the repository history, the file the log was opened from
+
+// gitLogMax is the number of commits listed
+const gitLogMax = 2000
+
+// gitLogEntry is a commit of the list, path is the name of the file in that commit for the file history
+type gitLogEntry struct {
+	hash    string
+	date    string
+	author  string
+	subject string
+	path    string
+}
+
+// gitLog is the history shown in a log view
+type gitLog struct {
+	root    string
+	file    string // file of the history, relative to root
+	from    string // file of the view that opened the repository history, for git:show
+	entries []gitLogEntry
+}
+
+// readGitLog runs git log, with --follow and the name of the file in each commit when file is not empty
+func readGitLog(root, file string) ([]gitLogEntry, error) {
+	args := []string{"-C", root, "log", fmt.Sprint("-n", gitLogMax), "--date=short", "--format=%x00%h%x09%ad%x09%an%x09%s"}
+	if file != "" {
+		args = append(args, "--follow", "--name-only", "--", file)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %s", strings.TrimSpace(string(out)))
+	}
+	var entries []gitLogEntry
+	for l := range strings.SplitSeq(string(out), "\n") {
+		if header, ok := strings.CutPrefix(l, "\x00"); ok {
+			fields := strings.SplitN(header, "\t", 4)
+			if len(fields) < 4 {
+				continue
+			}
+			entries = append(entries, gitLogEntry{hash: fields[0], date: fields[1], author: fields[2], subject: fields[3], path: file})
+		} else if l != "" && len(entries) > 0 {
+			entries[len(entries)-1].path = l
+		}
+	}
+	return entries, nil
+}
+
+// String renders a line for each commit
+func (g *gitLog) String() string {
+	var sb strings.Builder
+	for _, e := range g.entries {
+		author := []rune(e.author)
+		if len(author) > 16 {
+			author = author[:16]
+		}
+		fmt.Fprintf(&sb, "%s %s %-16s %s\n", e.hash, e.date, string(author), e.subject)
+	}
+	return sb.String()
+}
+
+// GitLog opens the history of the repository, or of the current file when file is true
+func GitLog(file bool) {
+	v := CurView()
+	root, rel := workingDir, ""
+	if file {
+		if v.Type != vtDefault || v.Buf.Path == "" {
+			messenger.Warning("File history only works on files")
+			return
+		}
+		path, _ := filepath.Abs(v.Buf.Path)
+		var err error
+		if root, rel, err = gitRepoPath(path); err != nil {
+			messenger.Error(err.Error())
+			return
+		}
+	} else if !git.enabled && !git.CheckGit() {
+		messenger.Warning("Not a git repository")
+		return
+	}
+	entries, err := readGitLog(root, rel)
+	if err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		messenger.Information("No commits")
+		return
+	}
+	g := &gitLog{root: root, file: rel, entries: entries}
+	if v.Type == vtDefault {
+		g.from = v.Buf.Path
+	}
+	v.AddTab(false)
+	CurView().OpenBuffer(NewBufferFromString(g.String(), ""))
+	CurView().Buf.Settings["filetype"] = "git-log"
+	CurView().Type = vtLog
+	CurView().Buf.UpdateRules()
+	if rel != "" {
+		CurView().Buf.Fname = "git-log " + filepath.Base(rel)
+	} else {
+		CurView().Buf.Fname = "git-log"
+	}
+	SetLocalOption("ruler", "false", CurView())
+	SetLocalOption("softwrap", "false", CurView())
+	CurView().onKey = g.key
+	navigationMode = true
+	if rel != "" {
+		messenger.Information(len(entries), " commits, Enter shows the diff, o opens the file at the revision")
+	} else {
+		messenger.Information(len(entries), " commits, Enter shows the diff, o opens a file at the revision")
+	}
+}
+
+// key shows the commit under the cursor on Enter, or opens the file at that revision on o
+func (g *gitLog) key(v *View, e *tcell.EventKey) bool {
+	y := v.Cursor.Y
+	if y >= len(g.entries) {
+		return false
+	}
+	entry := g.entries[y]
+	switch {
+	case e.Key() == tcell.KeyEnter:
+		if g.file != "" {
+			GitShow(g.root, entry.hash, entry.path)
+		} else {
+			GitShow(g.root, entry.hash)
+		}
+		return true
+	case e.Key() == tcell.KeyRune && e.Rune() == 'o':
+		if g.file != "" {
+			// the name of the file in that commit, it may have been renamed since
+			GitOpenRevision(g.root, entry.path, entry.hash)
+			return true
+		}
+		input, canceled := messenger.Prompt("> ", strings.TrimSpace("git:show "+entry.hash+" "+g.from), "Command", CommandCompletion)
+		if !canceled {
+			HandleCommand(input)
+		}
+		return true
+	}
+	return false
+}
+
+// GitShowFile opens the file as it was in the revision, the current file by default
+func GitShowFile(args []string) {
+	if len(args) == 0 {
+		messenger.Warning("Usage: git:show <rev> [file]")
+		return
+	}
+	path := ""
+	if len(args) > 1 {
+		path = ReplaceHome(args[1])
+	} else if v := CurView(); v.Type == vtDefault && v.Buf.Path != "" {
+		path = v.Buf.Path
+	} else {
+		messenger.Warning("Which file? git:show <rev> <file>")
+		return
+	}
+	path, _ = filepath.Abs(path)
+	root, rel, err := gitRepoPath(path)
+	if err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	GitOpenRevision(root, rel, args[0])
+}
+
+// GitOpenRevision opens the file as it was in the revision in a read only buffer of a new tab
+func GitOpenRevision(root, file, hash string) {
+	out, err := exec.Command("git", "-C", root, "show", hash+":"+file).Output()
+	if err != nil {
+		messenger.Error(file, " does not exist in ", hash)
+		return
+	}
+	filetype := symbolFiletype(filepath.Join(root, file))
+	CurView().AddTab(false)
+	CurView().OpenBuffer(NewBufferFromString(string(out), ""))
+	b := CurView().Buf
+	if filetype != "" {
+		b.Settings["filetype"] = filetype
+		b.UpdateRules()
+	}
+	b.Fname = filepath.Base(file) + "@" + hash
+	b.RO = true
+	CurView().Type.Readonly = true
+}
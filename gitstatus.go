@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// gitStatusDelay groups the refresh requests that come together, like saving all the buffers
+const gitStatusDelay = 300 * time.Millisecond
+
+// gitStatusTimeout stops the git commands of a refresh that take too long
+const gitStatusTimeout = 10 * time.Second
+
 // Gitstatus struc to hold git status state
 type Gitstatus struct {
 	enabled bool
 	status  string
 	fgcolor map[string]string
 	bgcolor string
+
+	// The status is read in the background, only one refresh runs at a time
+	timer   *time.Timer
+	running sync.Mutex
 }
 
 // NewGitStatus create git status object
@@ -29,7 +45,7 @@ func (g *Gitstatus) CheckGit() bool {
 	if g.enabled {
 		return true
 	}
-	_, err := ExecCommand("git", "status", "--porcelain")
+	_, err := ExecCommand("git", "rev-parse", "--is-inside-work-tree")
 	if err == nil {
 		g.enabled = true
 		return true
@@ -38,73 +54,122 @@ func (g *Gitstatus) CheckGit() bool {
 	return false
 }
 
-// GitSetStatus validate, status, branch
-// create string to display in statusbar
+// GitSetStatus refreshes the status shown in the statusbar
+// The git commands run in the background after a short delay, the result is applied in the main loop
 func (g *Gitstatus) GitSetStatus() {
 	if !g.enabled {
 		return
 	}
-	status, err := ExecCommand("git", "status", "--porcelain")
-	if err != nil {
-		g.enabled = false
-		g.status = " "
+	if g.timer != nil {
+		g.timer.Reset(gitStatusDelay)
+		return
+	}
+	g.timer = time.AfterFunc(gitStatusDelay, g.refresh)
+}
+
+// gitStatusResult is the status read by a refresh
+type gitStatusResult struct {
+	enabled bool
+	status  string
+	fgcolor map[string]string
+}
+
+// refresh reads the status and sends it to the main loop
+func (g *Gitstatus) refresh() {
+	g.running.Lock()
+	defer g.running.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+	defer cancel()
+	r, err := readGitStatus(ctx)
+	if ctx.Err() != nil {
+		jobs <- JobFunction{func(string, ...string) {
+			messenger.AddLog("git status took more than ", gitStatusTimeout, ", status not updated")
+		}, "", nil}
 		return
 	}
-	// git 2.22+
-	branch, err := ExecCommand("git", "branch", "--show-current")
 	if err != nil {
-		// git -2.22
-		branch = ""
-		text, err := ExecCommand("git", "branch")
-		if err != nil {
-			TermMessage(text)
-			g.enabled = false
-			g.status = " "
-			return
-		}
-		re := regexp.MustCompile(`\* (\w+)`)
-		matches := re.FindStringSubmatch(text)
-		if matches != nil {
-			branch = matches[1]
+		r = gitStatusResult{status: " ", fgcolor: make(map[string]string)}
+	}
+	jobs <- JobFunction{func(string, ...string) {
+		g.enabled = r.enabled
+		g.status = r.status
+		g.fgcolor = r.fgcolor
+		if CurView() != nil {
+			CurView().sline.Display()
 		}
-	} else if branch != "" {
-		branch = branch[:len(branch)-1]
+	}, "", nil}
+}
+
+// gitCommand runs a git command that is canceled with the context
+func gitCommand(ctx context.Context, arg ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", arg...).Output()
+	return string(out), err
+}
+
+// gitBranchRegex reads the branch line of git status --porcelain --branch
+var gitBranchRegex = regexp.MustCompile(`^## (?:No commits yet on |Initial commit on )?([^ .]+(?:\.[^ .]+)*?)(?:\.\.\.\S+)?(?: \[(.*)\])?$`)
+
+// readGitStatus validate, status, branch, commits ahead and behind the upstream, stashes
+// create string to display in statusbar
+func readGitStatus(ctx context.Context) (gitStatusResult, error) {
+	r := gitStatusResult{enabled: true, fgcolor: make(map[string]string)}
+	status, err := gitCommand(ctx, "status", "--porcelain", "--branch")
+	if err != nil {
+		return r, err
 	}
-	g.status = ""
-	g.enabled = true
 	lines := strings.Split(status, "\n")
+	branch := ""
+	if matches := gitBranchRegex.FindStringSubmatch(lines[0]); matches != nil {
+		branch = matches[1]
+		for track := range strings.SplitSeq(matches[2], ", ") {
+			if n, ok := strings.CutPrefix(track, "ahead "); ok {
+				branch += " ↑" + n
+			} else if n, ok := strings.CutPrefix(track, "behind "); ok {
+				branch += " ↓" + n
+			}
+		}
+	} else if strings.HasPrefix(lines[0], "## HEAD (no branch)") {
+		// detached head, the commit checked out
+		branch = "HEAD"
+		if out, err := gitCommand(ctx, "rev-parse", "--short", "HEAD"); err == nil {
+			branch += " " + strings.TrimSpace(out)
+		}
+	}
+	if out, err := gitCommand(ctx, "rev-list", "--walk-reflogs", "--count", "refs/stash"); err == nil {
+		if n, _ := strconv.Atoi(strings.TrimSpace(out)); n > 0 {
+			branch += fmt.Sprint(" ≡", n)
+		}
+	}
 	m := false
 	u := false
 	s := false
-	for _, l := range lines {
+	for _, l := range lines[1:] {
 		if (!m || !s) && strings.Contains(l, "M") {
 			if !s && (strings.Contains(l, "MM ") || strings.Contains(l, "M  ")) {
 				// staged
-				g.status = g.status + "+"
-				g.fgcolor["+"] = "gold"
+				r.status = r.status + "+"
+				r.fgcolor["+"] = "gold"
 				s = true
 			}
 			if !m && (strings.Contains(l, "MM ") || strings.Contains(l, " M ")) {
 				m = true
-				g.status = g.status + "m"
-				g.fgcolor["m"] = "red"
+				r.status = r.status + "m"
+				r.fgcolor["m"] = "red"
 			}
 		}
 		if !u && strings.Contains(l, "?? ") {
 			u = true
-			g.status = g.status + "u"
-			g.fgcolor["u"] = "#5fd7ff"
+			r.status = r.status + "u"
+			r.fgcolor["u"] = "#5fd7ff"
 		}
 		if u && m && s {
 			break
 		}
 	}
 	if m || s || u {
-		g.status = "] " + branch + "{" + g.status + "}"
+		r.status = "] " + branch + "{" + r.status + "}"
 	} else {
-		g.status = "[ " + branch + "}"
-	}
-	if CurView() != nil {
-		CurView().sline.Display()
+		r.status = "[ " + branch + "}"
 	}
+	return r, nil
 }
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// Project grep, walks the project directory with a pool of workers and shows every match
+// in a read only view. Enter on a result opens it, NextResult and PreviousResult walk the
+// results from any view
+
+const (
+	// files bigger than this are not searched
+	grepMaxFileSize = 4 * 1024 * 1024
+	// only the first matches, by file and line, are kept
+	grepMaxMatches = 10000
+)
+
+// grepMatch is a line of a project file that matches the search
+type grepMatch struct {
+	path string // relative to the project root
+	line int    // 0 based
+	col  int    // rune column of the match
+	end  int    // rune column where the match ends
+	text string
+}
+
+// grepResults are the matches of the last search, shown in buf
+type grepResults struct {
+	root    string
+	search  string
+	matches []grepMatch
+	current int
+	buf     *Buffer
+	// show the matches under the name of their file
+	grouped bool
+	// match shown in each line of buf, -1 for file names
+	rows []int
+}
+
+var searchResults *grepResults
+
+// : .gitignore
+
+// ignoreRule is a pattern of a .gitignore file, base is the directory of the file
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	// the pattern started with **/ and has directories, it matches under any directory
+	anyDir bool
+}
+
+// readGitignore parses the .gitignore of dir, if any
+func readGitignore(dir string) []ignoreRule {
+	var rules []ignoreRule
+	data, err := os.ReadFile(dir + "/.gitignore")
+	if err != nil {
+		return rules
+	}
+	for l := range strings.SplitSeq(string(data), "\n") {
+		l = strings.TrimRight(l, " \r")
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		r := ignoreRule{base: dir}
+		if strings.HasPrefix(l, "!") {
+			r.negate = true
+			l = l[1:]
+		}
+		l = strings.TrimPrefix(l, `\`)
+		l = strings.TrimSuffix(l, "/**")
+		if strings.HasSuffix(l, "/") {
+			r.dirOnly = true
+			l = strings.TrimRight(l, "/")
+		}
+		if after, ok := strings.CutPrefix(l, "**/"); ok {
+			l = after
+			r.anyDir = strings.Contains(l, "/")
+		} else if strings.Contains(l, "/") {
+			r.anchored = true
+			l = strings.TrimPrefix(l, "/")
+		}
+		r.pattern = l
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anyDir {
+		// try the path from every directory below base
+		rel := strings.TrimPrefix(path, r.base+"/")
+		for {
+			if ok, _ := filepath.Match(r.pattern, rel); ok {
+				return true
+			}
+			i := strings.Index(rel, "/")
+			if i < 0 {
+				return false
+			}
+			rel = rel[i+1:]
+		}
+	}
+	name := filepath.Base(path)
+	if r.anchored {
+		name = strings.TrimPrefix(path, r.base+"/")
+	}
+	ok, _ := filepath.Match(r.pattern, name)
+	return ok
+}
+
+// ignored checks the rules in order, the last rule that matches decides
+func ignored(rules []ignoreRule, path string, isDir bool) bool {
+	ignore := false
+	for _, r := range rules {
+		if r.match(path, isDir) {
+			ignore = !r.negate
+		}
+	}
+	return ignore
+}
+
+// WalkProject sends every file of the project that is not ignored by a .gitignore
+func WalkProject(root string, files chan<- string) {
+	var walk func(dir string, rules []ignoreRule)
+	walk = func(dir string, rules []ignoreRule) {
+		rules = append(rules[:len(rules):len(rules)], readGitignore(dir)...)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if e.Name() == ".git" {
+				continue
+			}
+			path := dir + "/" + e.Name()
+			if ignored(rules, path, e.IsDir()) {
+				continue
+			}
+			if e.IsDir() {
+				walk(path, rules)
+			} else if e.Type().IsRegular() {
+				files <- path
+			}
+		}
+	}
+	walk(root, nil)
+}
+
+// : Search
+
+// grepFile returns the lines of the file that match, binary files are skipped
+func grepFile(r *regexp.Regexp, root, path string) []grepMatch {
+	var matches []grepMatch
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > grepMaxFileSize {
+		return matches
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return matches
+	}
+	rel, _ := filepath.Rel(root, path)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), grepMaxFileSize)
+	for i := 0; scanner.Scan(); i++ {
+		// the buffers keep the lines without the \r of crlf files
+		l := strings.TrimSuffix(scanner.Text(), "\r")
+		for _, m := range r.FindAllStringIndex(l, -1) {
+			if m[0] == m[1] {
+				continue
+			}
+			matches = append(matches, grepMatch{
+				path: rel,
+				line: i,
+				col:  utf8.RuneCountInString(l[:m[0]]),
+				end:  utf8.RuneCountInString(l[:m[1]]),
+				text: l,
+			})
+		}
+	}
+	return matches
+}
+
+// ProjectGrep searches r in all the files of root concurrently, results are sorted by file and line
+// The limit is applied after sorting, so the same search always keeps the same matches
+func ProjectGrep(r *regexp.Regexp, root string) []grepMatch {
+	files := make(chan string, 64)
+	results := make(chan []grepMatch, 64)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Go(func() {
+			for path := range files {
+				if m := grepFile(r, root, path); len(m) > 0 {
+					results <- m
+				}
+			}
+		})
+	}
+	go func() {
+		WalkProject(root, files)
+		close(files)
+		wg.Wait()
+		close(results)
+	}()
+	var matches []grepMatch
+	for m := range results {
+		matches = append(matches, m...)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].path != matches[j].path {
+			return matches[i].path < matches[j].path
+		}
+		return matches[i].line < matches[j].line
+	})
+	if len(matches) > grepMaxMatches {
+		matches = matches[:grepMaxMatches]
+	}
+	return matches
+}
+
+// projectDir returns the project directory of the buffer, where the project searches run
+func (v *View) projectDir() string {
+	dir := workingDir
+	if v.Buf.Path != "" {
+		dir = filepath.Dir(v.Buf.AbsPath)
+	}
+	return GetProjectDir(workingDir, dir)
+}
+
+// SearchGrep runs the search in the background and opens the results view when done
+func SearchGrep(search string) {
+	r, err := regexp.Compile(search)
+	if err != nil {
+		messenger.Error("Invalid regex: ", err.Error())
+		return
+	}
+	root := CurView().projectDir()
+	messenger.Information("Searching ", search, " in ", root, " ...")
+	go func() {
+		results := &grepResults{root: root, search: search, matches: ProjectGrep(r, root), current: -1}
+		jobs <- JobFunction{func(string, ...string) { results.show() }, "", nil}
+	}()
+}
+
+// : Results view
+
+func (g *grepResults) String() string {
+	var sb strings.Builder
+	g.rows = g.rows[:0]
+	for i, m := range g.matches {
+		if !g.grouped {
+			sb.WriteString(m.path + ":" + strconv.Itoa(m.line+1) + ":" + strconv.Itoa(m.col+1) + ": " + strings.TrimSpace(m.text) + "\n")
+			g.rows = append(g.rows, i)
+			continue
+		}
+		if i == 0 || g.matches[i-1].path != m.path {
+			n := 1
+			for n < len(g.matches)-i && g.matches[i+n].path == m.path {
+				n++
+			}
+			if i > 0 {
+				sb.WriteString("\n")
+				g.rows = append(g.rows, -1)
+			}
+			sb.WriteString(m.path + " (" + strconv.Itoa(n) + ")\n")
+			g.rows = append(g.rows, -1)
+		}
+		sb.WriteString("    " + strconv.Itoa(m.line+1) + ":" + strconv.Itoa(m.col+1) + ": " + strings.TrimSpace(m.text) + "\n")
+		g.rows = append(g.rows, i)
+	}
+	return sb.String()
+}
+
+// show opens the results in a new tab, or in the tab of the previous results
+func (g *grepResults) show() {
+	if len(g.matches) == 0 {
+		messenger.Warning("Not found : ", g.search)
+		return
+	}
+	reuse := false
+	if searchResults != nil {
+		if i, v := searchResults.view(); v != nil {
+			curTab = i
+			tabs[i].CurView = v.Num
+			reuse = true
+		}
+	}
+	searchResults = g
+	if !reuse {
+		CurView().AddTab(false)
+	}
+	CurView().OpenBuffer(NewBufferFromString(g.String(), ""))
+	CurView().Buf.Settings["filetype"] = "search-results"
+	CurView().Type = vtLog
+	CurView().Buf.UpdateRules()
+	CurView().Buf.Fname = "search: " + g.search
+	SetLocalOption("ruler", "false", CurView())
+	SetLocalOption("softwrap", "false", CurView())
+	CurView().onKey = g.key
+	navigationMode = true
+	g.buf = CurView().Buf
+	msg := fmt.Sprint(len(g.matches), " matches")
+	if g.grouped {
+		msg = fmt.Sprint(len(g.matches), " matches in ", g.files(), " files")
+	}
+	if len(g.matches) == grepMaxMatches {
+		msg += " (limit reached)"
+	}
+	messenger.Information(msg, ", Enter to open")
+}
+
+// files counts the files with matches
+func (g *grepResults) files() int {
+	n := 0
+	for i, m := range g.matches {
+		if i == 0 || g.matches[i-1].path != m.path {
+			n++
+		}
+	}
+	return n
+}
+
+// view returns the tab and view showing the results, nil if it was closed
+func (g *grepResults) view() (int, *View) {
+	for i, t := range tabs {
+		for _, v := range t.Views {
+			if v.Buf == g.buf {
+				return i, v
+			}
+		}
+	}
+	return 0, nil
+}
+
+// key opens the result under the cursor on Enter, or the first result of a file name
+func (g *grepResults) key(v *View, e *tcell.EventKey) bool {
+	y := v.Buf.Cursor.Y
+	if e.Key() != tcell.KeyEnter || y >= len(g.rows) {
+		return false
+	}
+	for ; y < len(g.rows); y++ {
+		if g.rows[y] >= 0 {
+			g.open(g.rows[y])
+			break
+		}
+	}
+	return true
+}
+
+// FocusFile switch to the view where path is open, or open it in a new tab
+// Returns nil if the file could not be opened
+func FocusFile(path string) *View {
+	for i, t := range tabs {
+		for _, v := range t.Views {
+			if v.Buf.AbsPath == path {
+				curTab = i
+				t.CurView = v.Num
+				return v
+			}
+		}
+	}
+	NewTab([]string{path})
+	if CurView().Buf.AbsPath != path {
+		return nil
+	}
+	return CurView()
+}
+
+// open the file of the n-th result with the match selected
+// Uses the tab where the file is already open, otherwise a new tab
+func (g *grepResults) open(n int) {
+	g.current = n
+	m := g.matches[n]
+	if FocusFile(filepath.Join(g.root, m.path)) == nil {
+		return
+	}
+	navigationMode = false
+	v := CurView()
+	v.Cursor.ResetSelection()
+	start := Loc{m.col, m.line}
+	if start.Y >= v.Buf.LinesNum() {
+		start = v.Buf.End()
+	}
+	v.Cursor.GotoLoc(start)
+	if m.end <= Count(v.Buf.Line(start.Y)) {
+		v.Cursor.SetSelectionStart(start)
+		v.Cursor.SetSelectionEnd(Loc{m.end, start.Y})
+	}
+	v.Relocate()
+	v.Center(false)
+	if g.buf != nil {
+		for y, row := range g.rows {
+			if row == n {
+				g.buf.Cursor.GotoLoc(Loc{0, y})
+				break
+			}
+		}
+	}
+	messenger.Information(fmt.Sprint("Result ", n+1, " of ", len(g.matches), " : ", m.path))
+}
+
+// NextResult opens the next result of the last project search
+func (v *View) NextResult(usePlugin bool) bool {
+	if searchResults == nil || len(searchResults.matches) == 0 {
+		messenger.Information("No search results")
+		return false
+	}
+	n := searchResults.current + 1
+	if n >= len(searchResults.matches) {
+		n = 0
+	}
+	searchResults.open(n)
+	return false
+}
+
+// PreviousResult opens the previous result of the last project search
+func (v *View) PreviousResult(usePlugin bool) bool {
+	if searchResults == nil || len(searchResults.matches) == 0 {
+		messenger.Information("No search results")
+		return false
+	}
+	n := searchResults.current - 1
+	if n < 0 {
+		n = len(searchResults.matches) - 1
+	}
+	searchResults.open(n)
+	return false
+}
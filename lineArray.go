@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"slices"
 	"unicode/utf8"
 
 	"github.com/hanspr/highlight"
@@ -34,6 +36,11 @@ func runeToByteIndex(n int, txt []byte) int {
 type Line struct {
 	data []byte
 
+	lineState
+}
+
+// lineState is the highlighting of a line
+type lineState struct {
 	state       highlight.State
 	match       highlight.LineMatch
 	rehighlight bool
@@ -41,8 +48,12 @@ type Line struct {
 
 // A LineArray simply stores and array of lines and makes it easy to insert
 // and delete in it
+// Files with more than LargeFileThreshold lines are stored in a piece table instead, with the
+// highlighting of their lines in states
 type LineArray struct {
-	lines []Line
+	lines  []Line
+	pt     *pieceTable
+	states []lineState
 }
 
 // Append efficiently appends lines together
@@ -64,7 +75,14 @@ func Append(slice []Line, data ...Line) []Line {
 }
 
 // NewLineArray returns a new line array from an array of bytes
+// Files with more than LargeFileThreshold lines are stored in a piece table
 func NewLineArray(size int64, reader io.Reader) *LineArray {
+	return newLineArray(size, reader, LargeFileThreshold)
+}
+
+// newLineArray reads the file line by line, and moves it to a piece table once it has more
+// than maxLines lines. A negative maxLines always keeps the lines
+func newLineArray(size int64, reader io.Reader, maxLines int) *LineArray {
 	la := new(LineArray)
 
 	la.lines = make([]Line, 0, 1000)
@@ -88,6 +106,9 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 
 		if n >= 1000 && loaded >= 0 {
 			totalLinesNum := int(float64(size) * (float64(n) / float64(loaded)))
+			if maxLines >= 0 {
+				totalLinesNum = min(totalLinesNum, maxLines)
+			}
 			newSlice := make([]Line, len(la.lines), totalLinesNum+10000)
 			copy(newSlice, la.lines)
 			la.lines = newSlice
@@ -100,14 +121,19 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 
 		if err != nil {
 			if err == io.EOF {
-				la.lines = Append(la.lines, Line{data[:], nil, nil, false})
+				la.lines = Append(la.lines, Line{data: data[:]})
 				// la.lines = Append(la.lines, Line{data[:len(data)]})
 			}
 			// Last line was read
 			break
 		} else {
 			// la.lines = Append(la.lines, Line{data[:len(data)-1]})
-			la.lines = Append(la.lines, Line{data[:len(data)-1], nil, nil, false})
+			la.lines = Append(la.lines, Line{data: data[:len(data)-1]})
+			if len(la.lines) == maxLines {
+				// the newline starts one more line
+				la.toPieceTable(br, size)
+				return la
+			}
 		}
 		n++
 	}
@@ -115,8 +141,41 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 	return la
 }
 
+// toPieceTable moves the lines read to a piece table, followed by the rest of the file
+func (la *LineArray) toPieceTable(br *bufio.Reader, size int64) {
+	var buf bytes.Buffer
+	buf.Grow(int(max(size, 0)) + bytes.MinRead)
+	for _, l := range la.lines {
+		buf.Write(l.data)
+		buf.WriteByte('\n')
+	}
+	buf.ReadFrom(br)
+	la.pt = newPieceTable(crlfToLf(buf.Bytes()))
+	la.lines = nil
+	la.states = make([]lineState, la.pt.lines)
+}
+
+// crlfToLf removes the \r of the line endings in place
+func crlfToLf(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\r\n")) {
+		return data
+	}
+	n := 0
+	for j := range data {
+		if data[j] == '\r' && j+1 < len(data) && data[j+1] == '\n' {
+			continue
+		}
+		data[n] = data[j]
+		n++
+	}
+	return data[:n]
+}
+
 // Returns the String representation of the LineArray
 func (la *LineArray) String() string {
+	if la.pt != nil {
+		return string(la.pt.bytes())
+	}
 	str := ""
 	for i, l := range la.lines {
 		str += string(l.data)
@@ -131,6 +190,12 @@ func (la *LineArray) String() string {
 // the line array is saved
 // It is the same as string but uses crlf or lf line endings depending
 func (la *LineArray) SaveString(useCrlf bool) string {
+	if la.pt != nil {
+		if useCrlf {
+			return string(bytes.ReplaceAll(la.pt.bytes(), []byte{'\n'}, []byte("\r\n")))
+		}
+		return string(la.pt.bytes())
+	}
 	str := ""
 	for i, l := range la.lines {
 		str += string(l.data)
@@ -144,15 +209,71 @@ func (la *LineArray) SaveString(useCrlf bool) string {
 	return str
 }
 
+// LineBytes returns a single line as an array of bytes, empty if the line does not exist
+func (la *LineArray) LineBytes(n int) []byte {
+	if n < 0 || n >= la.LinesNum() {
+		return []byte{}
+	}
+	if la.pt != nil {
+		return la.pt.line(n)
+	}
+	return la.lines[n].data
+}
+
+// LinesNum returns the number of lines
+func (la *LineArray) LinesNum() int {
+	if la.pt != nil {
+		return len(la.states)
+	}
+	return len(la.lines)
+}
+
+// setLine replaces the data of a line
+func (la *LineArray) setLine(n int, data []byte) {
+	if la.pt != nil {
+		start, end := la.pt.lineRange(n)
+		la.pt.delete(start, end)
+		la.pt.insert(start, data)
+		return
+	}
+	la.lines[n].data = data
+}
+
+// offset returns the offset of the location in the piece table
+func (la *LineArray) offset(pos Loc) int {
+	return la.pt.lineStart(pos.Y) + runeToByteIndex(pos.X, la.pt.line(pos.Y))
+}
+
+// linesChanged keeps the highlight states of the piece table in line with the text, after n lines
+// are added below line y, or removed if n is negative. Like Split, the state moves to the last line
+func (la *LineArray) linesChanged(y, n int) {
+	switch {
+	case n > 0:
+		la.states = slices.Insert(la.states, y+1, make([]lineState, n)...)
+		la.states[y+n].state = la.states[y].state
+		la.states[y] = lineState{rehighlight: true}
+	case n < 0:
+		la.states = slices.Delete(la.states, y+1, y+1-n)
+	}
+}
+
+// NewlineBelow, insertByte, JoinLines, Split, DeleteFromStart, DeleteLine and DeleteByte edit the
+// lines, they are only used without a piece table
+
 // NewlineBelow adds a newline below the given line number
 func (la *LineArray) NewlineBelow(y int) {
-	la.lines = append(la.lines, Line{[]byte{' '}, nil, nil, false})
+	la.lines = append(la.lines, Line{data: []byte{' '}})
 	copy(la.lines[y+2:], la.lines[y+1:])
-	la.lines[y+1] = Line{[]byte{}, la.lines[y].state, nil, false}
+	la.lines[y+1] = Line{[]byte{}, lineState{state: la.lines[y].state}}
 }
 
 // inserts a byte array at a given location
 func (la *LineArray) insert(pos Loc, value []byte) {
+	if la.pt != nil {
+		la.pt.insert(la.offset(pos), value)
+		la.linesChanged(pos.Y, bytes.Count(value, []byte{'\n'}))
+		return
+	}
 	x, y := runeToByteIndex(pos.X, la.lines[pos.Y].data), pos.Y
 	// x, y := pos.x, pos.y
 	for i := range len(value) {
@@ -195,6 +316,11 @@ func (la *LineArray) Split(pos Loc) {
 // removes from start to end
 func (la *LineArray) remove(start, end Loc) string {
 	sub := la.Substr(start, end)
+	if la.pt != nil {
+		la.pt.delete(la.offset(start), la.offset(end))
+		la.linesChanged(start.Y, start.Y-end.Y)
+		return sub
+	}
 	startX := runeToByteIndex(start.X, la.lines[start.Y].data)
 	endX := runeToByteIndex(end.X, la.lines[end.Y].data)
 	if start.Y == end.Y {
@@ -212,6 +338,11 @@ func (la *LineArray) remove(start, end Loc) string {
 
 // DeleteToEnd deletes from the end of a line to the position
 func (la *LineArray) DeleteToEnd(pos Loc) {
+	if la.pt != nil {
+		start, end := la.pt.lineRange(pos.Y)
+		la.pt.delete(start+pos.X, end)
+		return
+	}
 	la.lines[pos.Y].data = la.lines[pos.Y].data[:pos.X]
 }
 
@@ -232,6 +363,9 @@ func (la *LineArray) DeleteByte(pos Loc) {
 
 // Substr returns the string representation between two locations
 func (la *LineArray) Substr(start, end Loc) string {
+	if la.pt != nil {
+		return string(la.pt.slice(la.offset(start), la.offset(end)))
+	}
 	startX := runeToByteIndex(start.X, la.lines[start.Y].data)
 	endX := runeToByteIndex(end.X, la.lines[end.Y].data)
 	if start.Y == end.Y {
@@ -246,22 +380,40 @@ func (la *LineArray) Substr(start, end Loc) string {
 	return str
 }
 
+// lineState returns the highlighting of the given line number
+func (la *LineArray) lineState(lineN int) *lineState {
+	if la.pt != nil {
+		return &la.states[lineN]
+	}
+	return &la.lines[lineN].lineState
+}
+
 // State gets the highlight state for the given line number
 func (la *LineArray) State(lineN int) highlight.State {
-	return la.lines[lineN].state
+	return la.lineState(lineN).state
 }
 
 // SetState sets the highlight state at the given line number
 func (la *LineArray) SetState(lineN int, s highlight.State) {
-	la.lines[lineN].state = s
+	la.lineState(lineN).state = s
 }
 
 // SetMatch sets the match at the given line number
 func (la *LineArray) SetMatch(lineN int, m highlight.LineMatch) {
-	la.lines[lineN].match = m
+	la.lineState(lineN).match = m
 }
 
 // Match retrieves the match for the given line number
 func (la *LineArray) Match(lineN int) highlight.LineMatch {
-	return la.lines[lineN].match
+	return la.lineState(lineN).match
+}
+
+// Rehighlight checks if the highlighting of the line needs to be updated
+func (la *LineArray) Rehighlight(lineN int) bool {
+	return la.lineState(lineN).rehighlight
+}
+
+// SetRehighlight sets whether the highlighting of the line needs to be updated
+func (la *LineArray) SetRehighlight(lineN int, on bool) {
+	la.lineState(lineN).rehighlight = on
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestPieceTableEdits makes the same random edits on both storages and compares the text
+func TestPieceTableEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"a", "bc", "\n", "é", "xyz\n", "\n\n", "ñañ", ""}
+	for range 300 {
+		var sb strings.Builder
+		for range r.Intn(50) {
+			sb.WriteString(words[r.Intn(len(words))])
+		}
+		text := sb.String()
+		lines := newLineArray(int64(len(text)), strings.NewReader(text), -1)
+		pt := &LineArray{pt: newPieceTable([]byte(text)), states: make([]lineState, strings.Count(text, "\n")+1)}
+		loc := func() Loc {
+			y := r.Intn(lines.LinesNum())
+			return Loc{r.Intn(utf8.RuneCount(lines.LineBytes(y)) + 1), y}
+		}
+		for range 100 {
+			switch r.Intn(5) {
+			case 0, 1:
+				p, w := loc(), []byte(words[r.Intn(len(words))])
+				lines.insert(p, w)
+				pt.insert(p, w)
+			case 2:
+				start, end := loc(), loc()
+				if end.LessThan(start) {
+					start, end = end, start
+				}
+				if a, b := lines.remove(start, end), pt.remove(start, end); a != b {
+					t.Fatalf("remove returned %q and %q", a, b)
+				}
+			case 3:
+				y := r.Intn(lines.LinesNum())
+				x := r.Intn(len(lines.LineBytes(y)) + 1)
+				lines.DeleteToEnd(Loc{x, y})
+				pt.DeleteToEnd(Loc{x, y})
+			case 4:
+				y := r.Intn(lines.LinesNum())
+				lines.setLine(y, []byte("é\tq"))
+				pt.setLine(y, []byte("é\tq"))
+			}
+			if lines.String() != pt.String() || lines.LinesNum() != pt.LinesNum() || pt.pt.lines != pt.LinesNum() {
+				t.Fatalf("text %q, piece table %q", lines.String(), pt.String())
+			}
+			for i := range lines.LinesNum() {
+				if !bytes.Equal(lines.LineBytes(i), pt.LineBytes(i)) {
+					t.Fatalf("line %d is %q, piece table %q", i, lines.LineBytes(i), pt.LineBytes(i))
+				}
+			}
+		}
+	}
+}
+
+func TestLargeFileLoad(t *testing.T) {
+	fileformat = 0
+	text := strings.Repeat("line\r\n", LargeFileThreshold) + "last"
+	la := NewLineArray(int64(len(text)), strings.NewReader(text))
+	if la.pt == nil || fileformat != 2 || la.LinesNum() != LargeFileThreshold+1 {
+		t.Fatalf("piece table %v, fileformat %d, %d lines", la.pt != nil, fileformat, la.LinesNum())
+	}
+	if string(la.LineBytes(3)) != "line" || string(la.LineBytes(LargeFileThreshold)) != "last" || la.SaveString(true) != text {
+		t.Fatal("text changed by the load")
+	}
+	text = strings.Repeat("line\n", LargeFileThreshold-1) + "last"
+	if la := NewLineArray(int64(len(text)), strings.NewReader(text)); la.pt != nil || la.LinesNum() != LargeFileThreshold {
+		t.Fatal("a file of LargeFileThreshold lines must keep the lines")
+	}
+}
+
+// : Benchmarks, the storage of lines against the piece table on a file of 200000 lines
+
+var benchText = strings.Repeat("\tfmt.Println(\"hello, world\", count, total) // some comment text\n", 200000)
+
+var benchStorages = []struct {
+	name     string
+	maxLines int
+}{
+	{"lines", -1},
+	{"piecetable", LargeFileThreshold},
+}
+
+func benchLoad(maxLines int) *LineArray {
+	return newLineArray(int64(len(benchText)), strings.NewReader(benchText), maxLines)
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, s := range benchStorages {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(benchText)))
+			for range b.N {
+				benchLoad(s.maxLines)
+			}
+		})
+	}
+}
+
+// BenchmarkMemory reports the heap kept by the loaded file
+func BenchmarkMemory(b *testing.B) {
+	for _, s := range benchStorages {
+		b.Run(s.name, func(b *testing.B) {
+			var heap uint64
+			for range b.N {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				la := benchLoad(s.maxLines)
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap += after.HeapAlloc - before.HeapAlloc
+				runtime.KeepAlive(la)
+			}
+			b.ReportMetric(float64(heap)/float64(b.N)/(1<<20), "MB/file")
+		})
+	}
+}
+
+// benchInsert measures an insert, the file is loaded again every 1000 edits
+func benchInsert(b *testing.B, maxLines int, at func(i int) Loc, text string) {
+	var la *LineArray
+	for i := range b.N {
+		if i%1000 == 0 {
+			b.StopTimer()
+			la = benchLoad(maxLines)
+			b.StartTimer()
+		}
+		la.insert(at(i%1000), []byte(text))
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	scattered := func(i int) Loc { return Loc{5, i * 7919 % 190000} }
+	typing := func(i int) Loc { return Loc{5 + i, 100000} }
+	for _, s := range benchStorages {
+		b.Run("char/"+s.name, func(b *testing.B) { benchInsert(b, s.maxLines, scattered, "x") })
+		b.Run("newline/"+s.name, func(b *testing.B) { benchInsert(b, s.maxLines, scattered, "\n") })
+		b.Run("typing/"+s.name, func(b *testing.B) { benchInsert(b, s.maxLines, typing, "x") })
+	}
+}
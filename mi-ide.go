@@ -146,6 +146,10 @@ func LoadInput() []*Buffer {
 	var buf *Buffer
 
 	args := flag.Args()
+	if *flagDiff {
+		// The diff of the files is opened in this buffer when mi-ide is ready
+		return []*Buffer{NewBufferFromString("", "")}
+	}
 	buffers := make([]*Buffer, 0, len(args))
 	if _, err := os.Stat(configDir + "/new.txt"); err == nil {
 		os.Remove(configDir + "/new.txt")
@@ -343,7 +347,11 @@ func loadAll() {
 // Finish One Place Global Exit
 // to control anything that could be necessary (to have a clean exit) in a single point
 func Finish(status int) {
+	if *flagMergetool && status == 0 {
+		status = mergetoolStatus(flag.Args())
+	}
 	screen.DisableMouse()
+	gitCommits.Wait()
 	time.Sleep(100 * time.Millisecond)
 	if cursorHadColor {
 		screen.SetCursorColorShape("white", "")
@@ -359,6 +367,8 @@ func Finish(status int) {
 var flagVersion = flag.Bool("version", false, "Show the version number and information")
 var flagConfigDir = flag.String("config-dir", "", "Specify a custom location for the configuration directory")
 var flagStartPos = flag.String("startpos", "", "LINE,COL to start the cursor at when opening a buffer.")
+var flagDiff = flag.Bool("diff", false, "Compare two files side by side")
+var flagMergetool = flag.Bool("mergetool", false, "Exit with an error while the files still have merge conflicts")
 
 // var flagOptions = flag.Bool("options", false, "Show all option help")
 
@@ -391,6 +401,10 @@ func main() {
 		fmt.Println("    Specify a custom location for the configuration directory")
 		fmt.Println(colorBCyan + "--version" + colorReset)
 		fmt.Println("    Show the version number")
+		fmt.Println(colorBCyan + "--diff a b" + colorReset)
+		fmt.Println("    Compare two files side by side")
+		fmt.Println(colorBCyan + "--mergetool" + colorReset)
+		fmt.Println("    Exit with an error while the files still have merge conflicts, for git mergetool")
 		fmt.Println(colorBCyan + "\nQuick intro" + colorReset)
 		fmt.Println(colorBold + "    Ctrl-o     : " + colorReset + "Open file")
 		fmt.Println(colorBold + "    Ctrl-s     : " + colorReset + "Save")
@@ -429,6 +443,9 @@ func main() {
 	// Load the user's settings
 	InitGlobalSettings()
 
+	// Background work started while opening the files reports through jobs
+	jobs = make(chan JobFunction, 100)
+
 	if _, err := os.Stat(configDir + "/libs/shared.lua"); err == nil {
 		utf8ToShare, _ := CompileLua(configDir + "/libs/shared.lua")
 		DoCompiledFile(L, utf8ToShare)
@@ -454,6 +471,7 @@ func main() {
 	// In other words we need to shut down tcell before the program crashes
 	defer func() {
 		if err := recover(); err != nil {
+			CrashSwapFiles()
 			screen.Fini()
 			fmt.Println("mi-ide encountered an error:", err)
 			// Print the stack trace too
@@ -565,7 +583,6 @@ func main() {
 	// Access to Go stdlib
 	L.SetGlobal("import", luar.New(L, Import))
 
-	jobs = make(chan JobFunction, 100)
 	events = make(chan tcell.Event, 1000)
 
 	// Loading all plugins
@@ -582,6 +599,15 @@ func main() {
 	messenger.style = defStyle
 	CurView().SetCursorEscapeString()
 	git.GitSetStatus()
+	StartSwapFiles()
+	StartAutosave()
+	if *flagDiff {
+		if len(flag.Args()) != 2 {
+			messenger.Error("Usage: mi-ide -diff file1 file2")
+		} else {
+			DiffFiles(flag.Args()[0], flag.Args()[1])
+		}
+	}
 	// Here is the event loop which runs in a separate thread
 	go func() {
 		for {
@@ -594,6 +620,7 @@ func main() {
 	for {
 		// Display everything (if app is not running)
 		if apprunning == nil {
+			AutosaveOnFocus()
 			RedrawAll(true)
 		}
 
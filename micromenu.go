@@ -282,7 +282,7 @@ func (m *microMenu) GlobalConfigDialog() {
 		f.AddWindowBox("enc", Language.Translate("Global Settings"), 0, 0, width, height, true, nil, "", "")
 		keys := make([]string, 0, len(globalSettings))
 		for k := range globalSettings {
-			if strings.Contains(k, "mi-") {
+			if HiddenOption(k) {
 				continue
 			}
 			keys = append(keys, k)
@@ -379,7 +379,7 @@ func (m *microMenu) SaveSettings(name, value, event, when string, x, y int) bool
 		values["cursorcolor"] = "disabled"
 	}
 	for k := range globalSettings {
-		if strings.Contains(k, "mi-") {
+		if HiddenOption(k) {
 			continue
 		}
 		kind := reflect.TypeOf(globalSettings[k]).Kind()
@@ -1962,3 +1962,107 @@ func (m *microMenu) TransferCloudSettings(name, value, event, when string, x, y
 	m.Finish("SyncSettings")
 	return true
 }
+
+// ---------------------------------------
+// Git branches and stashes
+// ---------------------------------------
+
+// GitBranchDialog select a branch to checkout, or write the name of a new one
+func (m *microMenu) GitBranchDialog(branches []string, current string, callback func(map[string]string)) {
+	// Always rebuild, the branches change
+	m.myapp = nil
+	m.myapp = new(MicroApp)
+	m.myapp.New("mi-gitbranch")
+	m.myapp.Reset()
+	m.myapp.defStyle = StringToStyle("#ffffff,#262626")
+	_, h := screen.Size()
+	list := min(max(len(branches), 1), h-12)
+	width := 60
+	height := list + 8
+	f := m.myapp.AddFrame("f", -1, -1, width, height, "relative")
+	f.AddWindowBox("box", Language.Translate("Git branch"), 0, 0, width, height, true, nil, "", "")
+	f.AddWindowSelect("branch", "", current, strings.Join(branches, "|"), 2, 2, width-4, list, m.GitDialogButton, "", "")
+	lbl := Language.Translate("New branch:")
+	f.AddWindowTextBox("new", lbl+" ", "", "string", 2, list+3, width-6-Count(lbl), 200, m.GitDialogButton, "", "")
+	lbl = Language.Translate("Cancel")
+	f.AddWindowButton("cancel", " "+lbl+" ", "cancel", 2, height-2, m.GitDialogButton, "", "")
+	lbl = Language.Translate("Checkout")
+	f.AddWindowButton("checkout", " "+lbl+" ", "ok", width-Count(lbl)-5, height-2, m.GitDialogButton, "", "")
+	lbl0 := Language.Translate("Create")
+	f.AddWindowButton("create", " "+lbl0+" ", "ok", width-Count(lbl)-Count(lbl0)-10, height-2, m.GitDialogButton, "", "")
+	m.myapp.WindowFinish = callback
+	m.myapp.Finish = m.GitDialogFinish
+	m.myapp.Start()
+	f.SetFocus("new", "E")
+	apprunning = m.myapp
+}
+
+// GitStashDialog save the changes in a new stash, or apply, pop or drop the stash selected
+func (m *microMenu) GitStashDialog(stashes []string, callback func(map[string]string)) {
+	m.myapp = nil
+	m.myapp = new(MicroApp)
+	m.myapp.New("mi-gitstash")
+	m.myapp.Reset()
+	m.myapp.defStyle = StringToStyle("#ffffff,#262626")
+	_, h := screen.Size()
+	list := min(len(stashes), h-12)
+	width := 80
+	height := list + 8
+	if list == 0 {
+		height = 7
+	}
+	f := m.myapp.AddFrame("f", -1, -1, width, height, "relative")
+	f.AddWindowBox("box", Language.Translate("Git stash"), 0, 0, width, height, true, nil, "", "")
+	lbl := Language.Translate("Message:")
+	f.AddWindowTextBox("message", lbl+" ", "", "string", 2, 2, width-17-Count(lbl), 200, m.GitDialogButton, "", "")
+	lbl = Language.Translate("Push")
+	f.AddWindowButton("push", " "+lbl+" ", "ok", width-Count(lbl)-5, 2, m.GitDialogButton, "", "")
+	if list > 0 {
+		f.AddWindowSelect("stash", "", strings.Split(stashes[0], "]")[0], strings.Join(stashes, "|"), 2, 4, width-4, list, nil, "", "")
+		x := width - 3
+		for _, b := range []string{"drop", "pop", "apply"} {
+			lbl = Language.Translate(strings.ToUpper(b[:1]) + b[1:])
+			x -= Count(lbl) + 4
+			f.AddWindowButton(b, " "+lbl+" ", "ok", x, height-2, m.GitDialogButton, "", "")
+		}
+	}
+	lbl = Language.Translate("Cancel")
+	f.AddWindowButton("cancel", " "+lbl+" ", "cancel", 2, height-2, m.GitDialogButton, "", "")
+	m.myapp.WindowFinish = callback
+	m.myapp.Finish = m.GitDialogFinish
+	m.myapp.Start()
+	f.SetFocus("message", "E")
+	apprunning = m.myapp
+}
+
+// GitDialogButton the button pressed is the action, Enter on the text boxes and the branch list too
+func (m *microMenu) GitDialogButton(name, value, event, when string, x, y int) bool {
+	if when == "POST" {
+		return true
+	}
+	action := name
+	switch {
+	case event == "mouse-click1" && name != "branch":
+	case event == "Enter" && name == "new":
+		action = "create"
+	case event == "Enter" && name == "message":
+		action = "push"
+	case event == "Enter" && name == "branch":
+		action = "checkout"
+	default:
+		return true
+	}
+	values := m.myapp.GetValues()
+	values["action"] = action
+	callback := m.myapp.WindowFinish
+	m.Finish("Git")
+	if action != "cancel" {
+		callback(values)
+	}
+	return true
+}
+
+// GitDialogFinish closes the git dialogs without doing anything
+func (m *microMenu) GitDialogFinish(s string) {
+	m.Finish("Abort")
+}
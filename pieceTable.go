@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+)
+
+// pieceTable stores the text of a large file without a copy per line. The text is a list of
+// pieces of the file as read, which is never modified, and of a buffer where the inserted text
+// is appended. The newlines of both are indexed, so a line is found with binary searches
+type pieceTable struct {
+	orig, add     []byte
+	origNL, addNL []int // offsets of the newlines of orig and add
+	pieces        []piece
+
+	// prefix sums of the pieces, updated from the piece edited
+	offsets  []int // offset of the text where each piece starts
+	newlines []int // newlines before each piece
+	size     int
+	lines    int
+}
+
+// piece is a range of orig or add
+type piece struct {
+	add      bool
+	start    int
+	len      int
+	newlines int
+}
+
+// newPieceTable returns a table with the text, that is kept without copying it
+func newPieceTable(text []byte) *pieceTable {
+	pt := &pieceTable{orig: text, origNL: indexNewlines(text, 0, nil)}
+	if len(text) > 0 {
+		pt.pieces = []piece{{false, 0, len(text), len(pt.origNL)}}
+	}
+	pt.rebuild(0)
+	return pt
+}
+
+// indexNewlines appends the offsets of the newlines of text, plus base, to nl
+func indexNewlines(text []byte, base int, nl []int) []int {
+	for i := 0; ; {
+		j := bytes.IndexByte(text[i:], '\n')
+		if j < 0 {
+			return nl
+		}
+		nl = append(nl, base+i+j)
+		i += j + 1
+	}
+}
+
+// buffer returns the text and newlines that the piece points to
+func (pt *pieceTable) buffer(p piece) ([]byte, []int) {
+	if p.add {
+		return pt.add, pt.addNL
+	}
+	return pt.orig, pt.origNL
+}
+
+// firstNewline returns the index in the newlines of its buffer of the first newline of the piece
+func (pt *pieceTable) firstNewline(p piece) int {
+	_, nl := pt.buffer(p)
+	return sort.SearchInts(nl, p.start)
+}
+
+// rebuild updates the prefix sums from the piece i, the pieces before it did not change
+func (pt *pieceTable) rebuild(i int) {
+	pt.offsets = pt.offsets[:i]
+	pt.newlines = pt.newlines[:i]
+	pt.size, pt.lines = 0, 1
+	if i > 0 {
+		p := pt.pieces[i-1]
+		pt.size = pt.offsets[i-1] + p.len
+		pt.lines = pt.newlines[i-1] + p.newlines + 1
+	}
+	for _, p := range pt.pieces[i:] {
+		pt.offsets = append(pt.offsets, pt.size)
+		pt.newlines = append(pt.newlines, pt.lines-1)
+		pt.size += p.len
+		pt.lines += p.newlines
+	}
+}
+
+// lineStart returns the offset of the first byte of the line
+func (pt *pieceTable) lineStart(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= pt.lines {
+		return pt.size
+	}
+	// the piece with the nth newline, counting from 1
+	i := sort.Search(len(pt.pieces), func(i int) bool { return pt.newlines[i] >= n }) - 1
+	p := pt.pieces[i]
+	_, nl := pt.buffer(p)
+	pos := nl[pt.firstNewline(p)+n-pt.newlines[i]-1]
+	return pt.offsets[i] + pos - p.start + 1
+}
+
+// lineRange returns the offsets of the start and end of the line, without its newline
+func (pt *pieceTable) lineRange(n int) (int, int) {
+	if n+1 >= pt.lines {
+		return pt.lineStart(n), pt.size
+	}
+	return pt.lineStart(n), pt.lineStart(n+1) - 1
+}
+
+// find returns the piece that contains the offset, and the offset inside the piece
+// The offset at the end of the text returns len(pieces)
+func (pt *pieceTable) find(off int) (int, int) {
+	i := sort.Search(len(pt.pieces), func(i int) bool { return pt.offsets[i] > off }) - 1
+	if i < 0 || off-pt.offsets[i] >= pt.pieces[i].len {
+		return i + 1, 0
+	}
+	return i, off - pt.offsets[i]
+}
+
+// slice returns the text between the offsets, without copying if it is in one piece
+// The result can't be appended to in place, it has no spare capacity
+func (pt *pieceTable) slice(start, end int) []byte {
+	if start >= end {
+		return []byte{}
+	}
+	i, in := pt.find(start)
+	if p := pt.pieces[i]; in+end-start <= p.len {
+		b, _ := pt.buffer(p)
+		s := p.start + in
+		return b[s : s+end-start : s+end-start]
+	}
+	text := make([]byte, 0, end-start)
+	for n := end - start; n > 0; i, in = i+1, 0 {
+		p := pt.pieces[i]
+		b, _ := pt.buffer(p)
+		l := min(p.len-in, n)
+		text = append(text, b[p.start+in:p.start+in+l]...)
+		n -= l
+	}
+	return text
+}
+
+// line returns the text of the line without the newline
+func (pt *pieceTable) line(n int) []byte {
+	return pt.slice(pt.lineRange(n))
+}
+
+// split cuts the piece that contains the offset, so a piece starts there
+// Returns the index of that piece
+func (pt *pieceTable) split(off int) int {
+	i, in := pt.find(off)
+	if in == 0 {
+		return i
+	}
+	p := pt.pieces[i]
+	_, nl := pt.buffer(p)
+	left := sort.SearchInts(nl, p.start+in) - pt.firstNewline(p)
+	pt.pieces[i] = piece{p.add, p.start, in, left}
+	pt.pieces = slices.Insert(pt.pieces, i+1, piece{p.add, p.start + in, p.len - in, p.newlines - left})
+	pt.rebuild(i)
+	return i + 1
+}
+
+// insert adds the text at the offset
+func (pt *pieceTable) insert(off int, text []byte) {
+	if len(text) == 0 {
+		return
+	}
+	start := len(pt.add)
+	n := len(pt.addNL)
+	pt.addNL = indexNewlines(text, start, pt.addNL)
+	n = len(pt.addNL) - n
+	pt.add = append(pt.add, text...)
+	i := pt.split(off)
+	// typing extends the last piece inserted, instead of adding a piece per character
+	if i > 0 {
+		if p := &pt.pieces[i-1]; p.add && p.start+p.len == start {
+			p.len += len(text)
+			p.newlines += n
+			pt.rebuild(i - 1)
+			return
+		}
+	}
+	pt.pieces = slices.Insert(pt.pieces, i, piece{true, start, len(text), n})
+	pt.rebuild(i)
+}
+
+// delete removes the text between the offsets
+func (pt *pieceTable) delete(start, end int) {
+	if start >= end {
+		return
+	}
+	i := pt.split(start)
+	j := pt.split(end)
+	pt.pieces = append(pt.pieces[:i], pt.pieces[j:]...)
+	pt.rebuild(i)
+}
+
+// snapshot returns a copy of the table that is not changed by later edits, to read it from another goroutine
+// orig and add are shared, orig never changes and the text of add is only appended after its length
+func (pt *pieceTable) snapshot() *pieceTable {
+	c := *pt
+	c.pieces = slices.Clone(pt.pieces)
+	c.offsets = slices.Clone(pt.offsets)
+	c.newlines = slices.Clone(pt.newlines)
+	return &c
+}
+
+// bytes returns all the text
+func (pt *pieceTable) bytes() []byte {
+	return pt.slice(0, pt.size)
+}
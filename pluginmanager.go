@@ -214,22 +214,7 @@ func (pp *PluginPackage) UnmarshalJSON(data []byte) error {
 func GetAllPluginPackages() PluginPackages {
 	if allPluginPackages == nil {
 		getOption := func(name string) []string {
-			data := GetOption(name)
-			if strs, ok := data.([]string); ok {
-				return strs
-			}
-			if ifs, ok := data.([]any); ok {
-				result := make([]string, len(ifs))
-				for i, urlIf := range ifs {
-					if url, ok := urlIf.(string); ok {
-						result[i] = url
-					} else {
-						return nil
-					}
-				}
-				return result
-			}
-			return nil
+			return StringListOption(GetOption(name))
 		}
 
 		channels := PluginChannels{}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/hanspr/highlight"
+)
+
+// Find references, the whole word occurrences of the identifier under the cursor in the project
+// Occurrences inside comments and strings are dropped when there is a syntax file for the file type,
+// the results are shown grouped by file in the project search results view
+
+// syntaxFiles are the parsed syntax files, needed to resolve the includes of a definition
+var syntaxFiles []*highlight.File
+
+// syntaxDefs by filetype, nil if the filetype has no syntax file
+var syntaxDefs = make(map[string]*highlight.Def)
+
+// SyntaxDef returns the highlight definition of the filetype, must be called from the main loop
+// because parsing a definition registers its groups in the highlight package
+func SyntaxDef(filetype string) *highlight.Def {
+	if def, ok := syntaxDefs[filetype]; ok {
+		return def
+	}
+	if syntaxFiles == nil {
+		for _, f := range ListRuntimeFiles(RTSyntax) {
+			data, err := f.Data()
+			if err != nil {
+				continue
+			}
+			if file, err := highlight.ParseFile(data); err == nil {
+				syntaxFiles = append(syntaxFiles, file)
+			}
+		}
+	}
+	var def *highlight.Def
+	for _, file := range syntaxFiles {
+		if file.FileType != filetype {
+			continue
+		}
+		ftdetect, err := highlight.ParseFtDetect(file)
+		if err != nil {
+			break
+		}
+		header := &highlight.Header{FileType: file.FileType, FtDetect: ftdetect}
+		if def, err = highlight.ParseDef(file, header); err != nil {
+			def = nil
+			break
+		}
+		highlight.ResolveIncludes(def, syntaxFiles)
+		break
+	}
+	syntaxDefs[filetype] = def
+	return def
+}
+
+// noCodeGroups are the groups of the text that is not code: comments and strings
+func noCodeGroups() map[highlight.Group]bool {
+	groups := make(map[highlight.Group]bool)
+	for name, g := range highlight.Groups {
+		if strings.HasPrefix(name, "comment") || strings.HasPrefix(name, "constant.string") {
+			groups[g] = true
+		}
+	}
+	return groups
+}
+
+// groupAt returns the highlight group of the rune column of a line
+func groupAt(line highlight.LineMatch, col int) highlight.Group {
+	var group highlight.Group
+	start := -1
+	for c, g := range line {
+		if c <= col && c > start {
+			start = c
+			group = g
+		}
+	}
+	return group
+}
+
+// codeMatches drops the matches of the file that are inside comments or strings
+func codeMatches(def *highlight.Def, noCode map[highlight.Group]bool, path string, matches []grepMatch) []grepMatch {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return matches
+	}
+	lines := highlight.NewHighlighter(def).HighlightString(string(data))
+	var code []grepMatch
+	for _, m := range matches {
+		if m.line < len(lines) && noCode[groupAt(lines[m.line], m.col)] {
+			continue
+		}
+		code = append(code, m)
+	}
+	return code
+}
+
+// identRune checks if r can be part of an identifier
+func identRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wholeWord checks that the match is not part of a longer identifier
+func wholeWord(m grepMatch) bool {
+	line := []rune(m.text)
+	if m.col > 0 && identRune(line[m.col-1]) {
+		return false
+	}
+	return m.end >= len(line) || !identRune(line[m.end])
+}
+
+// cursorWord returns the selection, or the word under the cursor
+func (v *View) cursorWord() string {
+	if v.Cursor.HasSelection() {
+		return v.Cursor.GetSelection()
+	}
+	loc := v.Cursor.Loc
+	v.Cursor.SelectWord(false)
+	word := v.Cursor.GetSelection()
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = loc
+	return word
+}
+
+// FindReferences search in the project the whole word under the cursor
+func (v *View) FindReferences(usePlugin bool) bool {
+	word := v.cursorWord()
+	if word == "" || strings.Contains(word, "\n") {
+		messenger.Warning("Place the cursor on a word to find its references")
+		return false
+	}
+	r := regexp.MustCompile(regexp.QuoteMeta(word))
+	root := v.projectDir()
+	messenger.Information("Searching references of ", word, " in ", root, " ...")
+	go func() {
+		var matches []grepMatch
+		for _, m := range ProjectGrep(r, root) {
+			if wholeWord(m) {
+				matches = append(matches, m)
+			}
+		}
+		filetypes := make(map[string]string)
+		for _, m := range matches {
+			if _, ok := filetypes[m.path]; !ok {
+				filetypes[m.path] = symbolFiletype(filepath.Join(root, m.path))
+			}
+		}
+		jobs <- JobFunction{func(string, ...string) {
+			defs := make(map[string]*highlight.Def)
+			for _, ft := range filetypes {
+				if _, ok := defs[ft]; !ok && ft != "" {
+					defs[ft] = SyntaxDef(ft)
+				}
+			}
+			noCode := noCodeGroups()
+			go func() {
+				results := &grepResults{root: root, search: "references of " + word, current: -1, grouped: true}
+				results.matches = filterReferences(root, matches, filetypes, defs, noCode)
+				jobs <- JobFunction{func(string, ...string) { results.show() }, "", nil}
+			}()
+		}, "", nil}
+	}()
+	return false
+}
+
+// filterReferences removes the matches inside comments and strings, one file per worker
+func filterReferences(root string, matches []grepMatch, filetypes map[string]string, defs map[string]*highlight.Def, noCode map[highlight.Group]bool) []grepMatch {
+	var byFile [][]grepMatch
+	for i, m := range matches {
+		if i == 0 || matches[i-1].path != m.path {
+			byFile = append(byFile, nil)
+		}
+		byFile[len(byFile)-1] = append(byFile[len(byFile)-1], m)
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for i, ms := range byFile {
+		def := defs[filetypes[ms[0].path]]
+		if def == nil {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Go(func() {
+			byFile[i] = codeMatches(def, noCode, filepath.Join(root, ms[0].path), ms)
+			<-sem
+		})
+	}
+	wg.Wait()
+	var filtered []grepMatch
+	for _, ms := range byFile {
+		filtered = append(filtered, ms...)
+	}
+	return filtered
+}
+
+// : Rename
+
+// RenameSymbol asks the new name of the word under the cursor and previews its replacement in the project
+func (v *View) RenameSymbol(usePlugin bool) bool {
+	word := v.cursorWord()
+	if word == "" || strings.Contains(word, "\n") {
+		messenger.Warning("Place the cursor on a word to rename it")
+		return false
+	}
+	name, canceled := messenger.Prompt("Rename "+word+" to: ", word, "Rename", NoCompletion)
+	if canceled {
+		return false
+	}
+	v.renameSymbol(word, strings.TrimSpace(name))
+	return false
+}
+
+// renameSymbol replaces the whole word occurrences of word in the project files of the same filetype
+// The changes are shown in the project replace preview to accept them
+func (v *View) renameSymbol(word, name string) {
+	if name == "" || name == word {
+		messenger.Information("Rename canceled")
+		return
+	}
+	r := regexp.MustCompile(regexp.QuoteMeta(word))
+	root := v.projectDir()
+	filetype := ""
+	if v.Buf.Path != "" {
+		filetype = symbolFiletype(v.Buf.AbsPath)
+	}
+	messenger.Information("Searching ", word, " in ", root, " ...")
+	go func() {
+		var matches []grepMatch
+		sameType := make(map[string]bool)
+		for _, m := range ProjectGrep(r, root) {
+			if !wholeWord(m) {
+				continue
+			}
+			same, ok := sameType[m.path]
+			if !ok {
+				same = filetype == "" || symbolFiletype(filepath.Join(root, m.path)) == filetype
+				sameType[m.path] = same
+			}
+			if same {
+				matches = append(matches, m)
+			}
+		}
+		p := newProjectReplace("Rename "+word+" to "+name, root, matches, func(line string, ms []grepMatch) string {
+			runes := []rune(line)
+			// from the last match so the columns of the previous ones do not move
+			for i := len(ms) - 1; i >= 0; i-- {
+				runes = append(runes[:ms[i].col:ms[i].col], append([]rune(name), runes[ms[i].end:]...)...)
+			}
+			return string(runes)
+		})
+		jobs <- JobFunction{func(string, ...string) { p.show() }, "", nil}
+	}()
+}
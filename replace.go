@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// Project replace, the changes are shown grouped by file in a preview view where each one can be
+// accepted or rejected. The accepted changes are applied through the buffer of each file, so every
+// file gets its own undo history and has to be saved by the user
+
+// replaceHunk is the change of one line
+type replaceHunk struct {
+	line     int // 0 based
+	old      string
+	new      string
+	accepted bool
+}
+
+// replaceFile are the changes of one file
+type replaceFile struct {
+	path  string // relative to the project root
+	hunks []*replaceHunk
+}
+
+// replaceRow maps a line of the preview to its file or hunk
+type replaceRow struct {
+	file *replaceFile
+	hunk *replaceHunk
+}
+
+// projectReplace is a preview of changes waiting to be applied
+type projectReplace struct {
+	root  string
+	title string
+	files []*replaceFile
+	rows  []replaceRow
+	buf   *Buffer
+}
+
+// newProjectReplace groups the matches by file and line, change returns the new text of a line given its matches
+// Lines that change does not modify are not included
+func newProjectReplace(title, root string, matches []grepMatch, change func(line string, matches []grepMatch) string) *projectReplace {
+	p := &projectReplace{root: root, title: title}
+	byLine := make(map[string]map[int][]grepMatch)
+	for _, m := range matches {
+		if byLine[m.path] == nil {
+			byLine[m.path] = make(map[int][]grepMatch)
+		}
+		byLine[m.path][m.line] = append(byLine[m.path][m.line], m)
+	}
+	paths := make([]string, 0, len(byLine))
+	for path := range byLine {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f := &replaceFile{path: path}
+		lines := make([]int, 0, len(byLine[path]))
+		for l := range byLine[path] {
+			lines = append(lines, l)
+		}
+		sort.Ints(lines)
+		for _, l := range lines {
+			ms := byLine[path][l]
+			text := change(ms[0].text, ms)
+			if text == ms[0].text {
+				continue
+			}
+			f.hunks = append(f.hunks, &replaceHunk{line: l, old: ms[0].text, new: text, accepted: true})
+		}
+		if len(f.hunks) > 0 {
+			p.files = append(p.files, f)
+		}
+	}
+	return p
+}
+
+// ProjectReplace searches the regex in the project and previews the replacements
+func ProjectReplace(search, replace string) {
+	r, err := regexp.Compile(search)
+	if err != nil {
+		messenger.Error("Invalid regex: ", err.Error())
+		return
+	}
+	root := CurView().projectDir()
+	messenger.Information("Searching ", search, " in ", root, " ...")
+	go func() {
+		matches := ProjectGrep(r, root)
+		p := newProjectReplace("Replace "+search+" with "+replace, root, matches, func(line string, ms []grepMatch) string {
+			return r.ReplaceAllString(line, replace)
+		})
+		jobs <- JobFunction{func(string, ...string) { p.show() }, "", nil}
+	}()
+}
+
+// : Preview
+
+func checkbox(on bool) string {
+	if on {
+		return "[x] "
+	}
+	return "[ ] "
+}
+
+func (p *projectReplace) accepted() (files, hunks int) {
+	for _, f := range p.files {
+		n := 0
+		for _, h := range f.hunks {
+			if h.accepted {
+				n++
+			}
+		}
+		if n > 0 {
+			files++
+			hunks += n
+		}
+	}
+	return
+}
+
+// render the preview and the map of its lines
+func (p *projectReplace) render() string {
+	var sb strings.Builder
+	files, hunks := p.accepted()
+	p.rows = p.rows[:0]
+	row := func(f *replaceFile, h *replaceHunk, text string) {
+		sb.WriteString(text + "\n")
+		p.rows = append(p.rows, replaceRow{f, h})
+	}
+	row(nil, nil, fmt.Sprint(p.title, " : ", hunks, " changes in ", files, " files"))
+	row(nil, nil, "Space toggle change (file on its name), Enter open, Ctrl-s apply accepted changes, Ctrl-w close")
+	for _, f := range p.files {
+		all := true
+		for _, h := range f.hunks {
+			all = all && h.accepted
+		}
+		row(nil, nil, "")
+		row(f, nil, checkbox(all)+f.path+" ("+strconv.Itoa(len(f.hunks))+")")
+		for _, h := range f.hunks {
+			num := strconv.Itoa(h.line + 1)
+			row(f, h, "    "+checkbox(h.accepted)+num+" - "+strings.TrimSpace(h.old))
+			row(f, h, "    "+strings.Repeat(" ", 4+len(num))+" + "+strings.TrimSpace(h.new))
+		}
+	}
+	return sb.String()
+}
+
+// show opens the preview in a new tab
+func (p *projectReplace) show() {
+	if len(p.files) == 0 {
+		messenger.Warning("Nothing to replace")
+		return
+	}
+	CurView().AddTab(false)
+	CurView().OpenBuffer(NewBufferFromString(p.render(), ""))
+	CurView().Buf.Settings["filetype"] = "replace-preview"
+	CurView().Type = vtLog
+	CurView().Buf.UpdateRules()
+	CurView().Buf.Fname = "replace preview"
+	SetLocalOption("ruler", "false", CurView())
+	SetLocalOption("softwrap", "false", CurView())
+	CurView().onKey = p.key
+	navigationMode = true
+	p.buf = CurView().Buf
+	files, hunks := p.accepted()
+	messenger.Information(fmt.Sprint(hunks, " changes in ", files, " files, Ctrl-s to apply"))
+}
+
+// refresh renders the preview again keeping the cursor line
+func (p *projectReplace) refresh(v *View) {
+	loc := v.Buf.Cursor.Loc
+	v.Buf.remove(v.Buf.Start(), v.Buf.End())
+	v.Buf.insert(v.Buf.Start(), []byte(p.render()))
+	v.Buf.IsModified = false
+	if loc.Y >= v.Buf.LinesNum() {
+		loc = v.Buf.End()
+	}
+	v.Buf.Cursor.GotoLoc(Loc{0, loc.Y})
+}
+
+// key handles the keys of the preview
+func (p *projectReplace) key(v *View, e *tcell.EventKey) bool {
+	y := v.Buf.Cursor.Y
+	var r replaceRow
+	if y < len(p.rows) {
+		r = p.rows[y]
+	}
+	switch {
+	case e.Key() == tcell.KeyRune && e.Rune() == ' ':
+		if r.hunk != nil {
+			r.hunk.accepted = !r.hunk.accepted
+		} else if r.file != nil {
+			all := true
+			for _, h := range r.file.hunks {
+				all = all && h.accepted
+			}
+			for _, h := range r.file.hunks {
+				h.accepted = !all
+			}
+		} else {
+			return true
+		}
+		p.refresh(v)
+		return true
+	case e.Key() == tcell.KeyEnter:
+		if r.file == nil {
+			return true
+		}
+		line := 0
+		if r.hunk != nil {
+			line = r.hunk.line
+		}
+		if fv := FocusFile(filepath.Join(p.root, r.file.path)); fv != nil {
+			navigationMode = false
+			fv.Cursor.ResetSelection()
+			fv.Cursor.GotoLoc(Loc{0, min(line, fv.Buf.LinesNum()-1)})
+			fv.Relocate()
+			fv.Center(false)
+		}
+		return true
+	case e.Key() == tcell.KeyCtrlS:
+		p.apply(v)
+		return true
+	}
+	return false
+}
+
+// apply the accepted changes and close the preview
+// A line that changed since the preview was built is skipped
+func (p *projectReplace) apply(preview *View) {
+	nfiles, nhunks, skipped := 0, 0, 0
+	last := ""
+	for _, f := range p.files {
+		var hunks []*replaceHunk
+		for _, h := range f.hunks {
+			if h.accepted {
+				hunks = append(hunks, h)
+			}
+		}
+		if len(hunks) == 0 {
+			continue
+		}
+		v := FocusFile(filepath.Join(p.root, f.path))
+		if v == nil {
+			messenger.AddLog("Replace, file not opened skipped: ", f.path)
+			skipped += len(hunks)
+			continue
+		}
+		if v.Type.Readonly || v.Buf.RO {
+			messenger.AddLog("Replace, read only file skipped: ", f.path)
+			skipped += len(hunks)
+			continue
+		}
+		// One undo reverts all the changes of the file
+		replacing = true
+		replaceTime = time.Now()
+		applied := 0
+		for i := len(hunks) - 1; i >= 0; i-- {
+			h := hunks[i]
+			if h.line >= v.Buf.LinesNum() || v.Buf.Line(h.line) != h.old {
+				messenger.AddLog("Replace, line changed since the preview skipped: ", f.path, ":", h.line+1)
+				skipped++
+				continue
+			}
+			v.Buf.Replace(Loc{0, h.line}, Loc{Count(h.old), h.line}, h.new)
+			applied++
+		}
+		replacing = false
+		if applied > 0 {
+			last = v.Buf.AbsPath
+			nfiles++
+			nhunks += applied
+			v.Cursor.ResetSelection()
+			v.Cursor.GotoLoc(Loc{0, hunks[0].line})
+			v.Relocate()
+		}
+	}
+	// Quit works on the current tab
+	curTab = preview.TabNum
+	tabs[curTab].CurView = preview.Num
+	preview.Quit(false)
+	navigationMode = false
+	if last != "" {
+		FocusFile(last)
+	}
+	msg := fmt.Sprint("Replaced ", nhunks, " lines in ", nfiles, " files, save them to keep the changes")
+	if skipped > 0 {
+		messenger.Warning(msg, ", ", skipped, " changes skipped (see the log)")
+		return
+	}
+	messenger.Success(msg)
+}
@@ -83,9 +83,9 @@ func searchDown(r *regexp.Regexp, v *View, start, end Loc) bool {
 			startX = -1
 		}
 
-		l := string(v.Buf.lines[i].data)
+		l := v.Buf.Line(i)
 		if newLineSearch && v.Buf.NumLines > i+1 {
-			l = l + "\n" + string(v.Buf.lines[i+1].data)
+			l = l + "\n" + v.Buf.Line(i+1)
 		}
 		match := r.FindAllStringIndex(l, -1)
 
@@ -97,7 +97,7 @@ func searchDown(r *regexp.Regexp, v *View, start, end Loc) bool {
 					nl := i
 					if newLineSearch {
 						nl++
-						Y = max(Y-len(v.Buf.lines[i].data)-1, 0)
+						Y = max(Y-len(v.Buf.LineBytes(i))-1, 0)
 					}
 					v.Cursor.SetSelectionStart(Loc{X, i})
 					v.Cursor.SetSelectionEnd(Loc{Y, nl})
@@ -131,9 +131,9 @@ func searchUp(r *regexp.Regexp, v *View, start, end Loc) bool {
 			startX = 9999999
 		}
 
-		l := string(v.Buf.lines[i].data)
+		l := v.Buf.Line(i)
 		if newLineSearch && v.Buf.NumLines > i+1 {
-			l = l + "\n" + string(v.Buf.lines[i+1].data)
+			l = l + "\n" + v.Buf.Line(i+1)
 		}
 		match := r.FindAllStringIndex(l, -1)
 
@@ -145,7 +145,7 @@ func searchUp(r *regexp.Regexp, v *View, start, end Loc) bool {
 					nl := i
 					if newLineSearch {
 						nl++
-						Y = max(Y-len(v.Buf.lines[i].data)-1, 0)
+						Y = max(Y-len(v.Buf.LineBytes(i))-1, 0)
 					}
 					v.Cursor.SetSelectionStart(Loc{X, i})
 					v.Cursor.SetSelectionEnd(Loc{Y, nl})
@@ -240,7 +240,7 @@ func FindLineWith(r *regexp.Regexp, v *View, start, end Loc, deep bool) (int, bo
 		start.Y = 0
 	}
 	for i := start.Y; i <= end.Y; i++ {
-		l := string(v.Buf.lines[i].data)
+		l := v.Buf.Line(i)
 		if r.MatchString(l) {
 			return i, true
 		}
@@ -28,6 +28,14 @@ var optionValidators = map[string]optionValidator{
 	"scrollmargin": validateNonNegativeValue,
 	"colorscheme":  validateColorscheme,
 	"fileformat":   validateLineEnding,
+
+	"ai-provider":       validateAIProvider,
+	"ai-thinkingbudget": validateNonNegativeValue,
+	"autosave-interval": validateNonNegativeValue,
+	"git-gutterbase":    validateGitGutterBase,
+	"swap-interval":     validatePositiveValue,
+	"undo-maxdays":      validatePositiveValue,
+	"undo-maxsize":      validatePositiveValue,
 }
 
 // InitGlobalSettings initializes the options map and sets all options to their default values
@@ -230,47 +238,103 @@ func GetOption(name string) any {
 	return GetGlobalOption(name)
 }
 
+// StringListOption converts a list option to []string, settings.json lists are read as []any
+func StringListOption(data any) []string {
+	if strs, ok := data.([]string); ok {
+		return strs
+	}
+	if ifs, ok := data.([]any); ok {
+		result := make([]string, len(ifs))
+		for i, v := range ifs {
+			if str, ok := v.(string); ok {
+				result[i] = str
+			} else {
+				return nil
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// hiddenOptionPrefixes are the option families set only from settings.json or the command line
+var hiddenOptionPrefixes = []string{"ai-", "autosave-", "git-", "index-", "swap-", "undo-"}
+
+// HiddenOption checks if the option is left out of the global settings dialog
+func HiddenOption(name string) bool {
+	if strings.Contains(name, "mi-") {
+		return true
+	}
+	for _, prefix := range hiddenOptionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // DefaultGlobalSettings returns the default global settings for mi-ide
 // Note that colorscheme is a global only option
 func DefaultGlobalSettings() map[string]any {
 	return map[string]any{
-		"autoclose":      true,
-		"autoindent":     true,
-		"autoreload":     true,
-		"basename":       false,
-		"colorscheme":    "default",
-		"cursorcolor":    "disabled",
-		"cursorline":     true,
-		"cursorshape":    "disabled",
-		"eofnewline":     false,
-		"fileformat":     "unix",
-		"indentchar":     " ",
-		"keepautoindent": false,
-		"lang":           "en_US",
-		"matchbrace":     false,
-		"matchbraceleft": false,
-		"mi-server":      "https://clip.microflow.com.mx:8443",
-		"mi-key":         "",
-		"mi-pass":        "",
-		"mi-phrase":      "",
-		"pluginchannels": []string{"https://raw.githubusercontent.com/mi-ide/plugin-channel/master/channel.json"},
-		"pluginrepos":    []string{},
-		"rmtrailingws":   false,
-		"ruler":          true,
-		"savehistory":    true,
-		"scrollmargin":   float64(3),
-		"softwrap":       false,
-		"smartindent":    false,
-		"smartpaste":     true,
-		"splitbottom":    true,
-		"splitright":     true,
-		"splitempty":     false,
-		"syntax":         true,
-		"tabmovement":    false,
-		"tabsize":        float64(4),
-		"tabstospaces":   false,
-		"tabindents":     false,
-		"usemouse":       true,
+		"ai-blockfiles":     []string{},
+		"ai-endpoint":       "",
+		"ai-keyenv":         "GEMINI_API_KEY",
+		"ai-model":          "gemini-3-flash-preview",
+		"ai-provider":       "gemini",
+		"ai-redact":         true,
+		"ai-redactpatterns": []string{},
+		"ai-thinkingbudget": float64(0),
+		"autoclose":         true,
+		"autoindent":        true,
+		"autoreload":        true,
+		"autosave-focus":    false,
+		"autosave-interval": float64(0),
+		"autosave-quit":     false,
+		"autosave-tab":      false,
+		"basename":          false,
+		"colorscheme":       "default",
+		"cursorcolor":       "disabled",
+		"cursorline":        true,
+		"cursorshape":       "disabled",
+		"eofnewline":        false,
+		"fileformat":        "unix",
+		"git-gutter":        true,
+		"git-gutterbase":    "HEAD",
+		"indentchar":        " ",
+		"index-ctags":       "tags",
+		"index-symbols":     true,
+		"keepautoindent":    false,
+		"lang":              "en_US",
+		"matchbrace":        false,
+		"matchbraceleft":    false,
+		"mi-server":         "https://clip.microflow.com.mx:8443",
+		"mi-key":            "",
+		"mi-pass":           "",
+		"mi-phrase":         "",
+		"pluginchannels":    []string{"https://raw.githubusercontent.com/mi-ide/plugin-channel/master/channel.json"},
+		"pluginrepos":       []string{},
+		"rmtrailingws":      false,
+		"ruler":             true,
+		"savehistory":       true,
+		"scrollmargin":      float64(3),
+		"softwrap":          false,
+		"smartindent":       false,
+		"smartpaste":        true,
+		"splitbottom":       true,
+		"splitright":        true,
+		"splitempty":        false,
+		"swap-enabled":      true,
+		"swap-interval":     float64(10),
+		"syntax":            true,
+		"tabmovement":       false,
+		"tabsize":           float64(4),
+		"tabstospaces":      false,
+		"tabindents":        false,
+		"undo-maxdays":      float64(30),
+		"undo-maxsize":      float64(1024),
+		"undo-persist":      true,
+		"usemouse":          true,
 	}
 }
 
@@ -354,8 +418,26 @@ func SetOption(option, value string) error {
 		return err
 	}
 
+	aiOption := strings.HasPrefix(option, "ai-") && option != "ai-redact"
+	if aiOption && gemini != nil && gemini.busy {
+		return errors.New(strings.ToLower(aiName()) + " is generating, cancel it first (Esc)")
+	}
+
 	globalSettings[option] = nativeValue
 
+	if aiOption && gemini != nil {
+		// Reconnect with the new configuration on next question, the conversation is kept
+		gemini.provider = nil
+	}
+
+	if strings.HasPrefix(option, "git-gutter") {
+		RefreshGitGutters()
+	}
+
+	if option == "autosave-interval" {
+		StartAutosave()
+	}
+
 	if option == "colorscheme" {
 		InitColorscheme()
 		for _, tab := range tabs {
@@ -522,3 +604,31 @@ func validateLineEnding(option string, value any) error {
 
 	return nil
 }
+
+func validateAIProvider(option string, value any) error {
+	provider, ok := value.(string)
+
+	if !ok {
+		return errors.New("expected string type for " + option)
+	}
+
+	if provider != "gemini" && provider != "openai" {
+		return errors.New(option + " must be either 'gemini' or 'openai'")
+	}
+
+	return nil
+}
+
+func validateGitGutterBase(option string, value any) error {
+	base, ok := value.(string)
+
+	if !ok {
+		return errors.New("expected string type for " + option)
+	}
+
+	if base != "HEAD" && base != "index" {
+		return errors.New(option + " must be either 'HEAD' or 'index'")
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hanspr/ioencoder"
+	"github.com/hanspr/tcell/v2"
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Side by side diff, the old and new versions in a vertical split. Filler lines keep the rows of both
+// sides aligned, so they scroll together. Changed lines are highlighted, and inside them the changed text
+
+// diffLine is the kind of a line of a side of the diff
+type diffLine uint8
+
+const (
+	diffSame diffLine = iota
+	// the line changed, its pair on the other side is changed too
+	diffChanged
+	// the line only exists on this side
+	diffOnly
+	// an empty line that stands for a line of the other side
+	diffFiller
+)
+
+// diffSide is the text shown on a side of the diff
+type diffSide struct {
+	name     string // name of the tab
+	text     string
+	filetype string
+}
+
+// diffPane is a side of the diff in a view
+type diffPane struct {
+	old   bool // the left side, its only lines were deleted
+	lines []diffLine
+	// changed rune columns of the changed lines, pairs start, end
+	chars map[int][]int
+	// first line of each change
+	starts []int
+}
+
+// buildSideDiff aligns the lines of old and new, returns the text and the lines of each side
+func buildSideDiff(old, new string) (string, string, *diffPane, *diffPane) {
+	left := &diffPane{old: true, chars: make(map[int][]int)}
+	right := &diffPane{chars: make(map[int][]int)}
+	var lt, rt strings.Builder
+	oldLines := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	newLines := strings.Split(strings.TrimSuffix(new, "\n"), "\n")
+	row := func(l string, lk diffLine, r string, rk diffLine) {
+		lt.WriteString(l + "\n")
+		rt.WriteString(r + "\n")
+		left.lines = append(left.lines, lk)
+		right.lines = append(right.lines, rk)
+	}
+	o, n := 0, 0
+	for _, h := range diffHunks(old, new) {
+		for ; n < h.start && o < len(oldLines); o, n = o+1, n+1 {
+			row(oldLines[o], diffSame, newLines[n], diffSame)
+		}
+		left.starts = append(left.starts, len(left.lines))
+		right.starts = append(right.starts, len(right.lines))
+		for i := range max(len(h.old), len(h.new)) {
+			switch {
+			case i < len(h.old) && i < len(h.new):
+				lc, rc := changedChars(h.old[i], h.new[i])
+				left.chars[len(left.lines)] = lc
+				right.chars[len(right.lines)] = rc
+				row(h.old[i], diffChanged, h.new[i], diffChanged)
+			case i < len(h.old):
+				row(h.old[i], diffOnly, "", diffFiller)
+			default:
+				row("", diffFiller, h.new[i], diffOnly)
+			}
+		}
+		o += len(h.old)
+		n += len(h.new)
+	}
+	for ; o < len(oldLines) && n < len(newLines); o, n = o+1, n+1 {
+		row(oldLines[o], diffSame, newLines[n], diffSame)
+	}
+	return strings.TrimSuffix(lt.String(), "\n"), strings.TrimSuffix(rt.String(), "\n"), left, right
+}
+
+// changedChars returns the rune columns that differ between the two versions of a line
+func changedChars(old, new string) ([]int, []int) {
+	differ := dmp.New()
+	diffs := differ.DiffCleanupSemantic(differ.DiffMain(old, new, false))
+	var oc, nc []int
+	o, n := 0, 0
+	for _, d := range diffs {
+		l := utf8.RuneCountInString(d.Text)
+		switch d.Type {
+		case dmp.DiffEqual:
+			o += l
+			n += l
+		case dmp.DiffDelete:
+			oc = append(oc, o, o+l)
+			o += l
+		case dmp.DiffInsert:
+			nc = append(nc, n, n+l)
+			n += l
+		}
+	}
+	return oc, nc
+}
+
+// background returns the background of the line, false for the lines that did not change
+func (p *diffPane) background(line int) (tcell.Color, bool) {
+	if line >= len(p.lines) {
+		return 0, false
+	}
+	var name, color string
+	switch p.lines[line] {
+	case diffChanged:
+		name, color = "diff-changed-line", "#262650"
+	case diffOnly:
+		if p.old {
+			name, color = "diff-deleted-line", "#4a0000"
+		} else {
+			name, color = "diff-added-line", "#003a00"
+		}
+	case diffFiller:
+		name, color = "diff-filler", "#262626"
+	default:
+		return 0, false
+	}
+	style := StringToStyle(color)
+	if s, ok := colorscheme[name]; ok {
+		style = s
+	}
+	fg, _, _ := style.Decompose()
+	return fg, true
+}
+
+// charBackground returns the background of a character of a changed line
+func (p *diffPane) charBackground(loc Loc, bg tcell.Color) tcell.Color {
+	chars := p.chars[loc.Y]
+	for i := 0; i+1 < len(chars); i += 2 {
+		if loc.X >= chars[i] && loc.X < chars[i+1] {
+			style := StringToStyle("#5f5f00")
+			if s, ok := colorscheme["diff-changed-text"]; ok {
+				style = s
+			}
+			fg, _, _ := style.Decompose()
+			return fg
+		}
+	}
+	return bg
+}
+
+// OpenSideDiff opens the old and new versions side by side, in a new tab or in the current view
+func OpenSideDiff(old, new diffSide, newTab bool) {
+	lt, rt, lp, rp := buildSideDiff(old.text, new.text)
+	if newTab {
+		CurView().AddTab(false)
+	}
+	left := CurView()
+	left.OpenBuffer(NewBufferFromString(lt, ""))
+	left.VSplitIndex(NewBufferFromString(rt, ""), left.Num+1)
+	right := CurView()
+	for _, p := range []struct {
+		v    *View
+		pane *diffPane
+		side diffSide
+	}{{left, lp, old}, {right, rp, new}} {
+		v := p.v
+		v.Type = vtLog
+		v.diff = p.pane
+		if p.side.filetype != "" {
+			v.Buf.Settings["filetype"] = p.side.filetype
+		}
+		v.Buf.UpdateRules()
+		v.Buf.Fname = p.side.name
+		v.onKey = diffKey
+		SetLocalOption("ruler", "false", v)
+		SetLocalOption("softwrap", "false", v)
+	}
+	left.syncView = right
+	right.syncView = left
+	navigationMode = true
+	if len(rp.starts) == 0 {
+		messenger.Information("No differences")
+		return
+	}
+	right.Cursor.GotoLoc(Loc{0, rp.starts[0]})
+	right.Relocate()
+	messenger.Information(len(rp.starts), " changes, n and N go to the next and previous change")
+}
+
+// diffKey moves to the next change on n and to the previous one on N
+func diffKey(v *View, e *tcell.EventKey) bool {
+	if e.Key() != tcell.KeyRune {
+		return false
+	}
+	switch e.Rune() {
+	case 'n':
+		v.NextHunk(false)
+	case 'N':
+		v.PreviousHunk(false)
+	default:
+		return false
+	}
+	return true
+}
+
+// GitSideDiff compares the current buffer with its version in the revision, HEAD by default
+func GitSideDiff(rev string) {
+	v := CurView()
+	if v.Type != vtDefault || v.Buf.Path == "" {
+		messenger.Warning("Side by side diff only works on files")
+		return
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	path, _ := filepath.Abs(v.Buf.Path)
+	ref := rev
+	if rev == "index" {
+		ref = ""
+	}
+	old, ok := readGitFile(path, ref)
+	if !ok {
+		messenger.Error(v.Buf.Fname, " is not in ", rev)
+		return
+	}
+	filetype := v.Buf.FileType()
+	OpenSideDiff(diffSide{v.Buf.Fname + "@" + rev, old, filetype}, diffSide{v.Buf.Fname, v.Buf.String(), filetype}, true)
+}
+
+// DiffWithDisk compares the file on disk with the buffer, to choose what to keep before saving or reloading
+func (b *Buffer) DiffWithDisk() {
+	if b.Path == "" {
+		messenger.Warning("The buffer has not been saved to a file")
+		return
+	}
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		messenger.Error(err.Error())
+		return
+	}
+	disk := string(data)
+	if b.encoding {
+		disk = ioencoder.New().DecodeString(b.encoder, disk)
+	}
+	disk = strings.ReplaceAll(disk, "\r\n", "\n")
+	filetype := b.FileType()
+	OpenSideDiff(diffSide{b.Fname + " (disk)", disk, filetype}, diffSide{b.Fname + " (buffer)", b.String(), filetype}, true)
+}
+
+// DiskDiff command, compares the current buffer with its file on disk
+func DiskDiff(args []string) {
+	if CurView().Type != vtDefault {
+		messenger.Warning("Only files can be compared with the disk")
+		return
+	}
+	CurView().Buf.DiffWithDisk()
+}
+
+// DiffFiles compares two files side by side in the current view, used by mi-ide -diff a b
+func DiffFiles(a, b string) {
+	var sides []diffSide
+	for _, path := range []string{a, b} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			messenger.Error(err.Error())
+			return
+		}
+		sides = append(sides, diffSide{filepath.Base(path), string(data), symbolFiletype(path)})
+	}
+	OpenSideDiff(sides[0], sides[1], false)
+}
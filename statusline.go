@@ -180,9 +180,15 @@ func (sline *Statusline) Display() {
 		if sline.view.Type.Readonly || sline.view.Buf.RO {
 			file += " (ro) "
 		}
+		if n := len(sline.view.Buf.conflicts); n > 0 {
+			file += fmt.Sprintf(" %d conflicts ", n)
+		}
 	}
 
 	rightText := Version
+	if gemini != nil && gemini.busy {
+		rightText = "Generating... " + rightText
+	}
 
 	statusLineStyle := defStyle.Reverse(true)
 	if style, ok := colorscheme["statusline"]; ok {
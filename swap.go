@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Swap files, the text of the modified buffers is written every swap-interval seconds to
+// configDir/buffers, and when mi-ide is killed by a signal or crashes. A clean save or close removes
+// the swap file. Opening a file with a swap newer than the file offers to recover it
+
+// swapFile is the saved text of a modified buffer
+type swapFile struct {
+	Path    string
+	Written time.Time
+	Pid     int
+	Text    string
+}
+
+// swapPath returns the swap file of the buffer
+func swapPath(b *Buffer) string {
+	path, _ := filepath.Abs(b.Path)
+	return configDir + "/buffers/" + strings.ReplaceAll(path+".swap", "/", "")
+}
+
+// swapWrites are the swap files being written in the background, waited for before exiting
+var swapWrites sync.WaitGroup
+
+// writeSwapFile writes the swap file at path, through a temporary file
+// so a crash while writing does not leave a broken swap
+func writeSwapFile(path string, s swapFile) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// WriteSwap writes the swap file of the buffer if it changed since the last one
+// The text of a large file is copied and written in the background, from a snapshot of its piece table
+func (b *Buffer) WriteSwap() {
+	if b.swapState == b.UndoTree.current || b.swapPending {
+		return
+	}
+	state := b.UndoTree.current
+	if b.pt != nil {
+		pt, path, s := b.pt.snapshot(), swapPath(b), swapFile{b.AbsPath, time.Now(), os.Getpid(), ""}
+		b.swapPending = true
+		swapWrites.Add(1)
+		go func() {
+			s.Text = string(pt.bytes())
+			err := writeSwapFile(path, s)
+			// done before the job, the exit paths wait for it from the main loop
+			swapWrites.Done()
+			jobs <- JobFunction{func(string, ...string) {
+				if !b.swapPending {
+					// removed meanwhile
+					return
+				}
+				b.swapPending = false
+				if err != nil {
+					messenger.AddLog("swap file of ", b.Path, ": ", err)
+					return
+				}
+				b.swapState = state
+			}, "", nil}
+		}()
+		return
+	}
+	if err := writeSwapFile(swapPath(b), swapFile{b.AbsPath, time.Now(), os.Getpid(), b.String()}); err != nil {
+		messenger.AddLog("swap file of ", b.Path, ": ", err)
+		return
+	}
+	b.swapState = state
+}
+
+// RemoveSwap deletes the swap file of the buffer
+func (b *Buffer) RemoveSwap() {
+	if b.swapPending {
+		// a write in the background would bring it back
+		swapWrites.Wait()
+		b.swapPending = false
+	}
+	os.Remove(swapPath(b))
+	b.swapState = nil
+}
+
+// WriteSwapFiles writes the swap files of the modified buffers, and removes the ones
+// of the buffers that are no longer modified
+func WriteSwapFiles() {
+	if !globalSettings["swap-enabled"].(bool) {
+		return
+	}
+	seen := make(map[*Buffer]bool)
+	for _, t := range tabs {
+		for _, v := range t.Views {
+			b := v.Buf
+			if seen[b] || v.Type != vtDefault || b.Path == "" {
+				continue
+			}
+			seen[b] = true
+			if b.Modified() {
+				b.WriteSwap()
+			} else if b.swapState != nil || b.swapPending {
+				b.RemoveSwap()
+			}
+		}
+	}
+}
+
+// StartSwapFiles writes the swap files periodically, and before exiting on a hangup or termination signal
+func StartSwapFiles() {
+	var schedule func()
+	schedule = func() {
+		interval := time.Duration(globalSettings["swap-interval"].(float64) * float64(time.Second))
+		time.AfterFunc(interval, func() {
+			jobs <- JobFunction{func(string, ...string) {
+				WriteSwapFiles()
+				schedule()
+			}, "", nil}
+		})
+	}
+	schedule()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM)
+	go func() {
+		<-signals
+		jobs <- JobFunction{func(string, ...string) {
+			WriteSwapFiles()
+			swapWrites.Wait()
+			messenger.SaveHistory()
+			Finish(1)
+		}, "", nil}
+	}()
+}
+
+// CrashSwapFiles writes the swap files when mi-ide panics, the buffers could be broken so errors are ignored
+func CrashSwapFiles() {
+	defer func() {
+		recover()
+	}()
+	WriteSwapFiles()
+	swapWrites.Wait()
+}
+
+// CheckSwap looks for a swap file of the buffer just opened, newer than the file
+// The recovery is asked from the main loop, once the editor is displayed
+func (b *Buffer) CheckSwap() {
+	if !globalSettings["swap-enabled"].(bool) {
+		return
+	}
+	data, err := os.ReadFile(swapPath(b))
+	if err != nil {
+		return
+	}
+	var s swapFile
+	err = json.Unmarshal(data, &s)
+	if err == nil && s.Path != b.AbsPath {
+		// the swap file name drops the slashes of the path, so another file can have the same one
+		messenger.AddLog("swap file of ", b.Path, " belongs to ", s.Path, ", ignored")
+		return
+	}
+	if err != nil || s.Text == b.String() {
+		os.Remove(swapPath(b))
+		return
+	}
+	if !s.Written.After(b.ModTime) {
+		messenger.AddLog("swap file of ", b.Path, " older than the file, removed")
+		os.Remove(swapPath(b))
+		return
+	}
+	jobs <- JobFunction{func(string, ...string) {
+		b.askSwap(s)
+	}, "", nil}
+}
+
+// askSwap offers to recover the swap file, compare it with the file or discard it
+// The recovered text is one change, undo goes back to the file
+func (b *Buffer) askSwap(s swapFile) {
+	r := []rune(Language.Translate("r"))[0]
+	d := []rune(Language.Translate("d"))[0]
+	x := []rune(Language.Translate("x"))[0]
+	prompt := Language.Translate("Unsaved changes of") + " " + b.GetName() + " " + Language.Translate("found from") + " " + s.Written.Format("2006-01-02 15:04:05") + ". " + Language.Translate("Recover? (r,d to recover and diff with disk,x to discard,esc)")
+	choice, canceled := messenger.LetterPrompt(true, prompt, r, d, x)
+	messenger.Reset()
+	messenger.Clear()
+	if canceled {
+		messenger.Information("Swap file kept until ", b.GetName(), " changes")
+		return
+	}
+	switch choice {
+	case r, d:
+		loc := b.Cursor.Loc
+		b.Replace(b.Start(), b.End(), s.Text)
+		b.WriteSwap()
+		b.Cursor.GotoLoc(loc)
+		b.Cursor.Relocate()
+		for _, t := range tabs {
+			for _, v := range t.Views {
+				if v.Buf == b {
+					v.Relocate()
+				}
+			}
+		}
+		if choice == d {
+			b.DiffWithDisk()
+		}
+		messenger.Success("Recovered ", b.GetName(), ", undo goes back to the file")
+	case x:
+		os.Remove(swapPath(b))
+		messenger.Information("Swap file discarded")
+	}
+}
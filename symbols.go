@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hanspr/highlight"
+)
+
+// Project symbol index, the declarations of every file of the project found with the findfuncregex
+// of its filetype, plus the entries of a ctags file when there is one. It is built in the background
+// the first time a file of the project is opened, saved in configDir/buffers and updated on every save
+
+const (
+	// default findfuncregex, %word% is replaced by the name searched
+	defaultFindFuncRegex = `^\s*(?:local )?(?:func(?:tion)?|def(?:n|un|ine)?|fn|sub|let|\w+\s+(?:\(.*?\)))\s+%word%\s*(?:(?:\(.*?\))|\s*\W)|%word%\s*:?=\s*(?:func(?:tion|fn|sub)[\s\{\(])`
+	// replaces %word% to capture the names while indexing
+	symbolCapture = `(?P<symbol>[\pL_$][\pL\pN_$]*)`
+	// files bigger than this are not indexed
+	symbolMaxFileSize = 1024 * 1024
+	// stop indexing after this many files, the project dir is probably too broad
+	symbolMaxFiles = 20000
+)
+
+// symbolDef is a declaration found in a file
+type symbolDef struct {
+	Name string `json:"name"`
+	// 0 based, -1 for ctags entries located by a pattern, resolved when looked up
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// indexedFile are the declarations of a file, ModTime tells if it has to be indexed again
+type indexedFile struct {
+	ModTime int64       `json:"modtime"`
+	Symbols []symbolDef `json:"symbols"`
+}
+
+// symbolLoc is a declaration found by a lookup
+type symbolLoc struct {
+	path string // absolute
+	line int    // 0 based
+	text string
+}
+
+// symbolIndex are the declarations of a project, paths are relative to root
+type symbolIndex struct {
+	root     string
+	mu       sync.Mutex
+	Files    map[string]*indexedFile `json:"files"`
+	Tags     map[string][]symbolDef  `json:"tags"`
+	TagsTime int64                   `json:"tagstime"`
+	ready    bool
+	// compiled findfuncregex by filetype, nil if the filetype has none
+	patterns map[string]*regexp.Regexp
+}
+
+// symbolIndexes by project root, only used from the main loop
+var symbolIndexes = make(map[string]*symbolIndex)
+
+// : Filetypes
+
+// symbolDetector tells the filetype of a file, from the ftdetect of a syntax file
+type symbolDetector struct {
+	filetype string
+	detect   [2]*regexp.Regexp
+}
+
+var (
+	symbolDetectors     []symbolDetector
+	symbolDetectorsOnce sync.Once
+)
+
+// symbolFiletype returns the filetype of path, "" if no syntax file matches
+func symbolFiletype(path string) string {
+	symbolDetectorsOnce.Do(func() {
+		for _, f := range ListRuntimeFiles(RTSyntax) {
+			data, err := f.Data()
+			if err != nil {
+				continue
+			}
+			file, err := highlight.ParseFile(data)
+			if err != nil {
+				continue
+			}
+			detect, err := highlight.ParseFtDetect(file)
+			if err != nil {
+				continue
+			}
+			symbolDetectors = append(symbolDetectors, symbolDetector{file.FileType, detect})
+		}
+	})
+	header := ReadHeaderBytes(path)
+	for _, d := range symbolDetectors {
+		if highlight.MatchFiletype(d.detect, path, header) {
+			return d.filetype
+		}
+	}
+	return ""
+}
+
+// findFuncRegex returns the findfuncregex of the filetype for this project
+// Read in the same order as the local settings: settings.json, settings/<ft>.json and the project .miide/<ft>.json
+func findFuncRegex(root, filetype string) string {
+	exp := defaultFindFuncRegex
+	if parsed, err := ReadFileJSON(configDir + "/settings.json"); err == nil {
+		if ft, ok := parsed["ft:"+filetype].(map[string]any); ok {
+			if s, ok := ft["findfuncregex"].(string); ok && s != "" {
+				exp = s
+			}
+		}
+	}
+	for _, filename := range []string{configDir + "/settings/" + filetype + ".json", root + "/.miide/" + filetype + ".json"} {
+		if parsed, err := ReadFileJSON(filename); err == nil {
+			if s, ok := parsed["findfuncregex"].(string); ok && s != "" {
+				exp = s
+			}
+		}
+	}
+	return exp
+}
+
+// pattern returns the regex that captures the declared names of the filetype
+// The lock is not held while sending to jobs, the main loop takes it to look up symbols
+func (s *symbolIndex) pattern(filetype string) *regexp.Regexp {
+	s.mu.Lock()
+	r, ok := s.patterns[filetype]
+	s.mu.Unlock()
+	if ok {
+		return r
+	}
+	var err error
+	if exp := findFuncRegex(s.root, filetype); strings.Contains(exp, "%word%") {
+		r, err = regexp.Compile(strings.ReplaceAll(exp, "%word%", symbolCapture))
+		if err != nil {
+			r = nil
+		}
+	}
+	s.mu.Lock()
+	if prev, ok := s.patterns[filetype]; ok {
+		// compiled meanwhile by another worker, which logged the error
+		s.mu.Unlock()
+		return prev
+	}
+	s.patterns[filetype] = r
+	s.mu.Unlock()
+	if err != nil {
+		msg := "Symbol index, invalid findfuncregex for " + filetype + ": " + err.Error()
+		jobs <- JobFunction{func(string, ...string) { messenger.AddLog(msg) }, "", nil}
+	}
+	return r
+}
+
+// : Index
+
+// symbolIndexPath is where the index of root is saved, named by a hash of the absolute path so
+// different paths never share an index
+func symbolIndexPath(root string) string {
+	path, _ := filepath.Abs(root)
+	sum := sha256.Sum256([]byte(path))
+	return configDir + "/buffers/" + hex.EncodeToString(sum[:]) + ".symbols"
+}
+
+// ProjectSymbols returns the index of the project of the buffer, the first call starts building it
+// Returns nil if index-symbols is off or the buffer has no project
+func ProjectSymbols(b *Buffer) *symbolIndex {
+	if !globalSettings["index-symbols"].(bool) || b.Path == "" {
+		return nil
+	}
+	root := GetProjectDir(workingDir, filepath.Dir(b.AbsPath))
+	if root == "/" || root == homeDir {
+		return nil
+	}
+	if s, ok := symbolIndexes[root]; ok {
+		return s
+	}
+	s := &symbolIndex{root: root, Files: make(map[string]*indexedFile), Tags: make(map[string][]symbolDef), patterns: make(map[string]*regexp.Regexp)}
+	symbolIndexes[root] = s
+	go s.build()
+	return s
+}
+
+// IndexSavedFile updates the declarations of a saved file in the index of its project
+func IndexSavedFile(b *Buffer) {
+	s := ProjectSymbols(b)
+	if s == nil || !s.isReady() {
+		return
+	}
+	path, _ := filepath.Abs(b.Path)
+	go func() {
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return
+		}
+		s.index(path, rel)
+		s.ctags()
+		s.save()
+	}()
+}
+
+func (s *symbolIndex) isReady() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+// build loads the saved index and brings it up to date, only files modified since are indexed again
+func (s *symbolIndex) build() {
+	if data, err := os.ReadFile(symbolIndexPath(s.root)); err == nil {
+		s.mu.Lock()
+		if err := json.Unmarshal(data, s); err != nil {
+			s.Files = make(map[string]*indexedFile)
+			s.Tags = make(map[string][]symbolDef)
+		}
+		s.mu.Unlock()
+	}
+	files := make(chan string, 64)
+	seen := make(map[string]bool)
+	var seenMu sync.Mutex
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Go(func() {
+			for path := range files {
+				rel, _ := filepath.Rel(s.root, path)
+				seenMu.Lock()
+				seen[rel] = true
+				seenMu.Unlock()
+				s.index(path, rel)
+			}
+		})
+	}
+	walk := make(chan string, 64)
+	go func() {
+		WalkProject(s.root, walk)
+		close(walk)
+	}()
+	n := 0
+	for path := range walk {
+		// keep draining the walk so it can finish
+		if n < symbolMaxFiles {
+			files <- path
+		}
+		n++
+	}
+	close(files)
+	wg.Wait()
+	if n > symbolMaxFiles {
+		msg := "Symbol index, " + s.root + " has more than " + strconv.Itoa(symbolMaxFiles) + " files, only the first ones were indexed"
+		jobs <- JobFunction{func(string, ...string) { messenger.AddLog(msg) }, "", nil}
+	}
+	s.mu.Lock()
+	for rel := range s.Files {
+		if !seen[rel] {
+			delete(s.Files, rel)
+		}
+	}
+	s.mu.Unlock()
+	s.ctags()
+	s.mu.Lock()
+	s.ready = true
+	s.mu.Unlock()
+	s.save()
+}
+
+// index reads the declarations of a file if it changed since it was indexed
+func (s *symbolIndex) index(path, rel string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.Files, rel)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Lock()
+	f, ok := s.Files[rel]
+	s.mu.Unlock()
+	if ok && f.ModTime == info.ModTime().Unix() {
+		return
+	}
+	f = &indexedFile{ModTime: info.ModTime().Unix()}
+	if ft := symbolFiletype(path); ft != "" && info.Size() <= symbolMaxFileSize {
+		if r := s.pattern(ft); r != nil {
+			f.Symbols = scanSymbols(r, path)
+		}
+	}
+	s.mu.Lock()
+	s.Files[rel] = f
+	s.mu.Unlock()
+}
+
+// scanSymbols returns the names captured by r in every line of the file, binary files are skipped
+func scanSymbols(r *regexp.Regexp, path string) []symbolDef {
+	var defs []symbolDef
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return defs
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), symbolMaxFileSize)
+	for i := 0; scanner.Scan(); i++ {
+		l := scanner.Text()
+		m := r.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		// the capture is repeated in each alternative of the regex, take the one that matched
+		for j, name := range r.SubexpNames() {
+			if name == "symbol" && m[j] != "" {
+				defs = append(defs, symbolDef{Name: m[j], Line: i, Text: l})
+				break
+			}
+		}
+	}
+	return defs
+}
+
+// save writes the index in configDir/buffers
+func (s *symbolIndex) save() {
+	s.mu.Lock()
+	data, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(symbolIndexPath(s.root), data, 0644); err != nil {
+		msg := "Symbol index, could not save: " + err.Error()
+		jobs <- JobFunction{func(string, ...string) { messenger.AddLog(msg) }, "", nil}
+	}
+}
+
+// : ctags
+
+// ctags reads the tags file set by index-ctags, relative to the project root, if it changed
+func (s *symbolIndex) ctags() {
+	name, _ := globalSettings["index-ctags"].(string)
+	if name == "" {
+		return
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.root, name)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		s.mu.Lock()
+		s.Tags = make(map[string][]symbolDef)
+		s.TagsTime = 0
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Lock()
+	same := s.TagsTime == info.ModTime().Unix()
+	s.mu.Unlock()
+	if same {
+		return
+	}
+	tags := readCtags(path, s.root)
+	s.mu.Lock()
+	s.Tags = tags
+	s.TagsTime = info.ModTime().Unix()
+	s.mu.Unlock()
+}
+
+// readCtags parses a ctags file: name<TAB>file<TAB>address;" extension fields
+// The address is a line number or a /^pattern$/ search
+func readCtags(path, root string) map[string][]symbolDef {
+	tags := make(map[string][]symbolDef)
+	file, err := os.Open(path)
+	if err != nil {
+		return tags
+	}
+	defer file.Close()
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), symbolMaxFileSize)
+	for scanner.Scan() {
+		l := scanner.Text()
+		if strings.HasPrefix(l, "!_TAG_") {
+			continue
+		}
+		fields := strings.SplitN(l, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		file := fields[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		addr := fields[2]
+		if i := strings.Index(addr, ";\"\t"); i >= 0 {
+			addr = addr[:i]
+		}
+		addr = strings.TrimSuffix(addr, ";\"")
+		def := symbolDef{Name: fields[0], Line: -1}
+		if n, err := strconv.Atoi(addr); err == nil {
+			def.Line = n - 1
+		} else if len(addr) > 2 && (addr[0] == '/' || addr[0] == '?') {
+			def.Text = ctagsPattern(addr[1 : len(addr)-1])
+		} else {
+			continue
+		}
+		tags[rel] = append(tags[rel], def)
+	}
+	return tags
+}
+
+// ctagsPattern returns the line searched by a ctags address pattern, without anchors nor escapes
+func ctagsPattern(p string) string {
+	p = strings.TrimPrefix(p, "^")
+	if strings.HasSuffix(p, "$") && !strings.HasSuffix(p, `\$`) {
+		p = p[:len(p)-1]
+	}
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+1 < len(p) {
+			i++
+		}
+		sb.WriteByte(p[i])
+	}
+	return sb.String()
+}
+
+// : Lookup
+
+// lookup returns the declarations of name, sorted by file and line
+func (s *symbolIndex) lookup(name string) []symbolLoc {
+	var locs []symbolLoc
+	found := make(map[symbolLoc]bool)
+	add := func(loc symbolLoc) {
+		key := symbolLoc{path: loc.path, line: loc.line}
+		if !found[key] {
+			found[key] = true
+			locs = append(locs, loc)
+		}
+	}
+	var tags []symbolLoc
+	s.mu.Lock()
+	for rel, f := range s.Files {
+		for _, d := range f.Symbols {
+			if d.Name == name {
+				add(symbolLoc{filepath.Join(s.root, rel), d.Line, d.Text})
+			}
+		}
+	}
+	for rel, defs := range s.Tags {
+		for _, d := range defs {
+			if d.Name == name {
+				tags = append(tags, symbolLoc{filepath.Join(s.root, rel), d.Line, d.Text})
+			}
+		}
+	}
+	s.mu.Unlock()
+	// ctags entries are located in the file as it is now
+	for _, t := range tags {
+		if t.line, t.text = locateTag(t.path, t.line, t.text); t.line >= 0 {
+			add(t)
+		}
+	}
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].path != locs[j].path {
+			return locs[i].path < locs[j].path
+		}
+		return locs[i].line < locs[j].line
+	})
+	return locs
+}
+
+// locateTag returns the line and text of a ctags entry, searching the pattern if there is no line number
+func locateTag(path string, line int, text string) (int, string) {
+	data, err := os.ReadFile(path)
+	if err != nil || (line < 0 && text == "") {
+		return -1, text
+	}
+	lines := strings.Split(string(data), "\n")
+	if line >= 0 {
+		if line >= len(lines) {
+			return -1, text
+		}
+		return line, lines[line]
+	}
+	for i, l := range lines {
+		if strings.Contains(l, text) {
+			return i, l
+		}
+	}
+	return -1, text
+}
+
+// functionHint returns the comments before the declaration at line and its first lines
+func functionHint(line, numLines int, get func(int) string) string {
+	comment := regexp.MustCompile(`^\s*(?:#|//|(?:<!)?--|/\*)`)
+	data := ""
+	for l := max(line-5, 0); l < min(line+4, numLines); l++ {
+		d := get(l)
+		if l < line {
+			if comment.MatchString(d) {
+				data = data + d + "\n"
+			}
+			continue
+		}
+		data = data + d + "\n"
+	}
+	return data
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Persistent undo, the undo tree of a file is saved next to its settings in configDir/buffers
+// when the file is saved, and restored when it is opened again.
+// The history is only restored if the content of the file did not change outside mi-ide
+
+// undoHistory is the saved history of a file
+type undoHistory struct {
+	// Hash of the content of the file when the history was saved
+	Hash  string
+	Saved time.Time
+	// Nodes of the tree in creation order, Current is the index of the saved state, -1 the root
+	Nodes   []undoRecord
+	Current int
+}
+
+// undoRecord is a node of the saved tree, Parent is the index of its parent, -1 the root
+type undoRecord struct {
+	Parent int
+	Event  *TextEvent
+}
+
+// undoFile returns the file of the undo history of the buffer
+func undoFile(b *Buffer) string {
+	path, _ := filepath.Abs(b.Path)
+	return configDir + "/buffers/" + strings.ReplaceAll(path+".undo", "/", "")
+}
+
+// contentHash identifies the content of the buffer
+func contentHash(b *Buffer) string {
+	// line by line, a large file is not copied
+	h := sha256.New()
+	for i := range b.LinesNum() {
+		if i > 0 {
+			h.Write([]byte{'\n'})
+		}
+		h.Write(b.LineBytes(i))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// undoMaxAge returns the oldest time of the changes kept, from the undo-maxdays setting
+func undoMaxAge() time.Time {
+	days := globalSettings["undo-maxdays"].(float64)
+	return time.Now().Add(-time.Duration(days*24) * time.Hour)
+}
+
+// records flattens the tree for saving, without the changes older than cutoff
+// Changes are newer than their parents, so the old states are the top of the tree. The states of the
+// current branch older than cutoff are merged into a new root, the other branches are dropped when
+// all their changes are old
+func (t *UndoTree) records(cutoff time.Time) ([]undoRecord, int) {
+	root := t.root
+	current := make(map[*undoNode]bool)
+	for _, n := range t.current.path() {
+		current[n] = true
+		if n.event.Time.Before(cutoff) {
+			root = n
+		}
+	}
+	var newest func(n *undoNode) time.Time
+	newest = func(n *undoNode) time.Time {
+		last := n.event.Time
+		for _, c := range n.children {
+			if l := newest(c); l.After(last) {
+				last = l
+			}
+		}
+		return last
+	}
+	keep := make(map[*undoNode]bool)
+	var walk func(n *undoNode)
+	walk = func(n *undoNode) {
+		for _, c := range n.children {
+			if current[c] || !newest(c).Before(cutoff) {
+				keep[c] = true
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+	index := map[*undoNode]int{root: -1}
+	var records []undoRecord
+	for _, n := range t.nodes {
+		if keep[n] {
+			index[n] = len(records)
+			records = append(records, undoRecord{index[n.parent], n.event})
+		}
+	}
+	return records, index[t.current]
+}
+
+// SaveUndoHistory writes the undo tree of the buffer, called after it is saved
+// The oldest changes are dropped to respect the undo-maxdays and undo-maxsize settings
+func (b *Buffer) SaveUndoHistory() {
+	if !globalSettings["undo-persist"].(bool) || b.Path == "" {
+		return
+	}
+	h := undoHistory{Hash: contentHash(b), Saved: time.Now()}
+	limit := int(globalSettings["undo-maxsize"].(float64) * 1024)
+	cutoff := undoMaxAge()
+	// too big, the cutoff moves forward a quarter of the changes each time
+	var times []time.Time
+	for _, n := range b.UndoTree.nodes {
+		times = append(times, n.event.Time)
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	step := max(1, len(times)/4)
+	for i := step - 1; ; i += step {
+		h.Nodes, h.Current = b.UndoTree.records(cutoff)
+		if len(h.Nodes) == 0 {
+			os.Remove(undoFile(b))
+			return
+		}
+		data, err := json.Marshal(h)
+		if err != nil {
+			messenger.AddLog("undo history of ", b.Path, ": ", err)
+			return
+		}
+		if len(data) <= limit {
+			if err := os.WriteFile(undoFile(b), data, 0600); err != nil {
+				messenger.AddLog("undo history of ", b.Path, ": ", err)
+			}
+			return
+		}
+		if last := times[min(i, len(times)-1)].Add(time.Nanosecond); last.After(cutoff) {
+			cutoff = last
+		}
+	}
+}
+
+// LoadUndoHistory restores the saved history of the buffer, if the file has the content it had when saved
+func (b *Buffer) LoadUndoHistory() {
+	if !globalSettings["undo-persist"].(bool) || b.Path == "" {
+		return
+	}
+	data, err := os.ReadFile(undoFile(b))
+	if err != nil {
+		return
+	}
+	var h undoHistory
+	if err := json.Unmarshal(data, &h); err != nil || h.Saved.Before(undoMaxAge()) {
+		os.Remove(undoFile(b))
+		return
+	}
+	if h.Hash != contentHash(b) {
+		// edited outside mi-ide, the history does not apply
+		return
+	}
+	t := NewUndoTree()
+	for _, r := range h.Nodes {
+		if r.Event == nil || r.Parent >= len(t.nodes) {
+			return
+		}
+		t.current = t.Node(r.Parent + 1)
+		t.add(r.Event)
+	}
+	t.current = t.Node(h.Current + 1)
+	for _, n := range t.current.path() {
+		n.parent.redo = n.index()
+	}
+	t.MarkSaved()
+	b.UndoTree = t
+}
+
+// PurgeUndo command, deletes the saved undo history of the current file, or of all the files with `all`
+func PurgeUndo(args []string) {
+	if len(args) > 0 && args[0] == "all" {
+		files, _ := filepath.Glob(configDir + "/buffers/*.undo")
+		for _, f := range files {
+			os.Remove(f)
+		}
+		messenger.Success("Deleted the undo history of ", len(files), " files")
+		return
+	}
+	b := CurView().Buf
+	if b.Path == "" {
+		messenger.Warning("The buffer has no file")
+		return
+	}
+	if err := os.Remove(undoFile(b)); err != nil {
+		messenger.Information("No saved undo history for ", b.Fname)
+		return
+	}
+	messenger.Success("Deleted the undo history of ", b.Fname)
+}
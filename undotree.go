@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hanspr/tcell/v2"
+)
+
+// UndoTree keeps every state of the buffer. Undoing and then editing starts a new branch,
+// the undone changes stay in the tree and can be reached again by jumping to their nodes
+type UndoTree struct {
+	root    *undoNode
+	current *undoNode
+	// state of the file when it was saved
+	saved *undoNode
+	// nodes in creation order, the seq of a node is its index + 1
+	nodes []*undoNode
+}
+
+// undoNode is a state of the buffer, reached by applying its event to the state of the parent
+type undoNode struct {
+	event    *TextEvent // nil for the root
+	parent   *undoNode
+	children []*undoNode // oldest first
+	redo     int         // child followed by redo, the last one created or visited
+	seq      int
+}
+
+// NewUndoTree returns a tree with the initial state only
+func NewUndoTree() *UndoTree {
+	t := new(UndoTree)
+	t.root = new(undoNode)
+	t.current = t.root
+	t.saved = t.root
+	return t
+}
+
+// Add appends a state after the current one, the new state becomes the current
+func (t *UndoTree) Add(e *TextEvent) {
+	if currentSnippet != nil {
+		return
+	}
+	t.add(e)
+}
+
+// add appends the node of the event, also used to restore a saved tree
+func (t *UndoTree) add(e *TextEvent) {
+	n := &undoNode{event: e, parent: t.current, seq: len(t.nodes) + 1}
+	t.current.children = append(t.current.children, n)
+	t.current.redo = len(t.current.children) - 1
+	t.current = n
+	t.nodes = append(t.nodes, n)
+}
+
+// Undoable returns the event that undo reverts, nil at the initial state
+func (t *UndoTree) Undoable() *TextEvent {
+	return t.current.event
+}
+
+// Redoable returns the event that redo applies, nil if the current state has no children
+func (t *UndoTree) Redoable() *TextEvent {
+	if len(t.current.children) == 0 {
+		return nil
+	}
+	return t.current.children[t.current.redo].event
+}
+
+// up moves to the parent state, returns the event to revert
+func (t *UndoTree) up() *TextEvent {
+	if currentSnippet != nil || t.current.parent == nil {
+		return nil
+	}
+	n := t.current
+	n.parent.redo = n.index()
+	t.current = n.parent
+	return n.event
+}
+
+// down moves to the child state followed by redo, returns the event to apply
+func (t *UndoTree) down() *TextEvent {
+	if currentSnippet != nil || len(t.current.children) == 0 {
+		return nil
+	}
+	t.current = t.current.children[t.current.redo]
+	return t.current.event
+}
+
+// index returns the position of the node in the children of its parent
+func (n *undoNode) index() int {
+	for i, c := range n.parent.children {
+		if c == n {
+			return i
+		}
+	}
+	return 0
+}
+
+// Saved checks if the current state is the one saved to the file
+func (t *UndoTree) Saved() bool {
+	return t.current == t.saved
+}
+
+// MarkSaved records the current state as the one saved to the file
+func (t *UndoTree) MarkSaved() {
+	t.saved = t.current
+}
+
+// Node returns the node with the seq, 0 is the initial state
+func (t *UndoTree) Node(seq int) *undoNode {
+	if seq <= 0 || seq > len(t.nodes) {
+		return t.root
+	}
+	return t.nodes[seq-1]
+}
+
+// path returns the nodes from the child of the root to n
+func (n *undoNode) path() []*undoNode {
+	var p []*undoNode
+	for ; n.parent != nil; n = n.parent {
+		p = append(p, n)
+	}
+	for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+		p[i], p[j] = p[j], p[i]
+	}
+	return p
+}
+
+// closeInTime checks if the events were made together, the way undo groups them
+func closeInTime(a, b *TextEvent) bool {
+	return b.Time.Sub(a.Time) <= undoThreshold*time.Millisecond
+}
+
+// Older returns the state before the group of changes that created the current state,
+// following the time of the changes instead of the branches
+func (t *UndoTree) Older() *undoNode {
+	i := t.current.seq - 1
+	if i < 0 {
+		return nil
+	}
+	for i > 0 && closeInTime(t.nodes[i-1].event, t.nodes[i].event) {
+		i--
+	}
+	return t.Node(i)
+}
+
+// Newer returns the state after the next group of changes in time
+func (t *UndoTree) Newer() *undoNode {
+	i := t.current.seq
+	if i >= len(t.nodes) {
+		return nil
+	}
+	for i+1 < len(t.nodes) && closeInTime(t.nodes[i].event, t.nodes[i+1].event) {
+		i++
+	}
+	return t.nodes[i]
+}
+
+// : Navigation
+
+// undoJump moves the buffer of the view to the state
+func (v *View) undoJump(n *undoNode) {
+	if v.Buf.curCursor == 0 {
+		v.Buf.clearCursors()
+	}
+	v.Buf.UndoJump(n)
+	if v.Buf.UndoTree.Saved() {
+		v.Buf.IsModified = false
+	}
+	v.Relocate()
+	if n.event == nil {
+		messenger.Information("Initial state")
+		return
+	}
+	messenger.Information("State #", n.seq, " of ", len(v.Buf.UndoTree.nodes), ", ", n.event.Time.Format("2006-01-02 15:04:05"))
+}
+
+// UndoOlder moves to the previous state in time, which can be in another branch of the undo tree
+func (v *View) UndoOlder(usePlugin bool) bool {
+	n := v.Buf.UndoTree.Older()
+	if n == nil {
+		messenger.Information("Already at the oldest change")
+		return false
+	}
+	v.undoJump(n)
+	return true
+}
+
+// UndoNewer moves to the next state in time, which can be in another branch of the undo tree
+func (v *View) UndoNewer(usePlugin bool) bool {
+	n := v.Buf.UndoTree.Newer()
+	if n == nil {
+		messenger.Information("Already at the newest change")
+		return false
+	}
+	v.undoJump(n)
+	return true
+}
+
+// : Undo tree view
+
+// undoTreeView lists the states of the undo tree of the buffer of a view
+// A line is a branch point, the end of a branch, or a pause in the changes, the way undo groups them.
+// The newest branch of a state continues at the same indentation, the older ones are indented
+type undoTreeView struct {
+	view  *View
+	nodes []*undoNode // state of each line
+}
+
+// stop checks if the state has a line in the view
+func (u *undoTreeView) stop(n *undoNode) bool {
+	t := u.view.Buf.UndoTree
+	return n == t.root || n == t.current || n == t.saved || len(n.children) != 1 || !closeInTime(n.event, n.children[0].event)
+}
+
+// render returns the lines of the tree
+func (u *undoTreeView) render() string {
+	var sb strings.Builder
+	t := u.view.Buf.UndoTree
+	u.nodes = nil
+	var walk func(n *undoNode, depth, changes int)
+	walk = func(n *undoNode, depth, changes int) {
+		if u.stop(n) {
+			u.nodes = append(u.nodes, n)
+			indent := strings.Repeat("  ", depth)
+			if n.event == nil {
+				fmt.Fprintf(&sb, "%s#%-6d %-19s initial", indent, n.seq, "")
+			} else {
+				plural, line := "s", 0
+				if changes == 1 {
+					plural = ""
+				}
+				if len(n.event.Deltas) > 0 {
+					line = n.event.Deltas[0].Start.Y + 1
+				}
+				fmt.Fprintf(&sb, "%s#%-6d %s %d change%s, line %d", indent, n.seq, n.event.Time.Format("2006-01-02 15:04:05"), changes, plural, line)
+			}
+			if n == t.saved {
+				sb.WriteString(" [saved]")
+			}
+			if n == t.current {
+				sb.WriteString(" < current")
+			}
+			sb.WriteString("\n")
+			changes = 0
+		}
+		for i, c := range n.children {
+			if i < len(n.children)-1 {
+				walk(c, depth+1, changes+1)
+			} else {
+				walk(c, depth, changes+1)
+			}
+		}
+	}
+	walk(t.root, 0, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// show writes the tree in the view, with the cursor on the current state
+func (u *undoTreeView) show(tv *View) {
+	tv.OpenBuffer(NewBufferFromString(u.render(), ""))
+	tv.onKey = u.key
+	tv.Buf.Fname = "undo " + u.view.Buf.Fname
+	SetLocalOption("ruler", "false", tv)
+	SetLocalOption("softwrap", "false", tv)
+	for i, n := range u.nodes {
+		if n == u.view.Buf.UndoTree.current {
+			tv.Cursor.GotoLoc(Loc{0, i})
+		}
+	}
+	tv.Relocate()
+}
+
+// key jumps to the state of the line under the cursor on Enter
+func (u *undoTreeView) key(v *View, e *tcell.EventKey) bool {
+	if e.Key() != tcell.KeyEnter || v.Cursor.Y >= len(u.nodes) {
+		return false
+	}
+	u.view.undoJump(u.nodes[v.Cursor.Y])
+	u.show(v)
+	return true
+}
+
+// ShowUndoTree opens the undo tree of the current buffer in a split
+func ShowUndoTree() {
+	v := CurView()
+	if v.Type != vtDefault {
+		messenger.Warning("The undo tree only works on files")
+		return
+	}
+	u := &undoTreeView{view: v}
+	w := v.Width
+	v.VSplitIndex(NewBufferFromString("", ""), v.Num+1)
+	tv := CurView()
+	tv.Type = vtLog
+	u.show(tv)
+	nv := min(60, w/2)
+	v.Width = w - nv
+	tv.Width = w - v.Width
+	tv.x = v.x + v.Width + 1
+	navigationMode = true
+	messenger.Information(len(v.Buf.UndoTree.nodes), " changes, Enter goes to the state of the line")
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/hanspr/shellwords"
 	"github.com/hanspr/tcell/v2"
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
 )
 
 // Util.go is a collection of utility functions that are used throughout
@@ -894,3 +895,29 @@ func GetProjectDir(wkdir, fdir string) string {
 	}
 	return fdir
 }
+
+// LineDiff compares a and b line by line, returns the lines prefixed with " ", "-" or "+"
+func LineDiff(a, b string) string {
+	differ := dmp.New()
+	ca, cb, lines := differ.DiffLinesToChars(a, b)
+	diffs := differ.DiffCharsToLines(differ.DiffMain(ca, cb, false), lines)
+	var sb strings.Builder
+	for _, d := range diffs {
+		prefix := " "
+		if d.Type == dmp.DiffInsert {
+			prefix = "+"
+		} else if d.Type == dmp.DiffDelete {
+			prefix = "-"
+		}
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l == "" {
+				continue
+			}
+			sb.WriteString(prefix + l)
+			if !strings.HasSuffix(l, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
@@ -111,6 +111,22 @@ type View struct {
 	splitNode *LeafNode
 
 	frozen bool
+
+	// Called before the key bindings in read only views, like the search results
+	// Returns true if the key was handled
+	onKey func(v *View, e *tcell.EventKey) bool
+
+	// Called when the view is closed, like the commit composer
+	onClose func(v *View)
+
+	// Called after the user saves the buffer of the view to its file
+	onSave func(v *View)
+
+	// A view that scrolls with this one, like the git blame of a file
+	syncView *View
+
+	// The side of a side by side diff shown in the view
+	diff *diffPane
 }
 
 // NewView returns a new fullscreen view
@@ -361,6 +377,9 @@ func (v *View) CanClose() bool {
 			return false
 		}
 	}
+	if v.Type == vtDefault && (v.Buf.swapState != nil || v.Buf.swapPending) {
+		v.Buf.RemoveSwap()
+	}
 	return true
 }
 
@@ -368,6 +387,7 @@ func (v *View) CanClose() bool {
 // This resets the topline, event handler and cursor.
 func (v *View) OpenBuffer(buf *Buffer) {
 	screen.Clear()
+	v.resetHooks()
 	v.Buf = buf
 	v.Cursor = &buf.Cursor
 	v.Topline = 0
@@ -389,6 +409,23 @@ func (v *View) OpenBuffer(buf *Buffer) {
 	GlobalPluginCall("onViewOpen", v)
 }
 
+// resetHooks runs the close action and removes the hooks of the buffer shown in the view,
+// like the commit composer, the search results or a side of a diff
+// A view that scrolls with this one, like the source of a blame, stops following it
+func (v *View) resetHooks() {
+	if v.onClose != nil {
+		v.onClose(v)
+	}
+	if v.syncView != nil && v.syncView.syncView == v {
+		v.syncView.syncView = nil
+	}
+	v.onKey = nil
+	v.onClose = nil
+	v.onSave = nil
+	v.syncView = nil
+	v.diff = nil
+}
+
 // Open opens the given file in the view
 func (v *View) Open(path string) {
 	buf, err := NewBufferFromFile(path)
@@ -686,8 +723,14 @@ func (v *View) HandleEvent(event tcell.Event) {
 	switch e := event.(type) {
 	case *tcell.EventKey:
 		isBinding := false
+		if v.onKey != nil && v.onKey(v, e) {
+			return
+		}
 		if navigationMode && e.Name() == "Esc" {
-			// Exist navigation mode
+			// Stop a gemini answer still streaming, otherwise exit navigation mode
+			if GeminiCancel() {
+				return
+			}
 			v.NavigationMode(true)
 			return
 		} else if ComboKeyActive {
@@ -1073,6 +1116,14 @@ func (v *View) SetLastView() {
 	LastView = v.Num
 }
 
+// lineBackground returns the background of the line in a side by side diff, or in a merge conflict
+func (v *View) lineBackground(line int) (tcell.Color, bool) {
+	if v.diff != nil {
+		return v.diff.background(line)
+	}
+	return v.Buf.conflictBackground(line)
+}
+
 // DisplayView draws the view to the screen
 func (v *View) DisplayView() {
 	ActiveView := true
@@ -1084,6 +1135,15 @@ func (v *View) DisplayView() {
 		v.leftCol = 0
 	}
 
+	if v.syncView != nil && CurView() == v.syncView {
+		v.Topline = v.syncView.Topline
+		if v.diff != nil {
+			v.leftCol = v.syncView.leftCol
+		}
+		if v.Type == vtLog {
+			v.Cursor.GotoLoc(Loc{0, min(v.syncView.Cursor.Y, v.Buf.LinesNum()-1)})
+		}
+	}
 	if v.Type == vtLog || v.Type == vtRaw {
 		// Log or raw views should always follow the cursor...
 		v.Relocate()
@@ -1140,6 +1200,12 @@ func (v *View) DisplayView() {
 		v.lineNumOffset += 2
 	}
 
+	// Without ruler the git change markers need their own column
+	hasGitMarkers := v.Buf.Settings["ruler"] != true && v.Buf.gitDiff != nil && len(v.Buf.gitDiff.hunks) > 0
+	if hasGitMarkers {
+		v.lineNumOffset++
+	}
+
 	divider := 0
 	if v.x != 0 {
 		// One space for the extra split divider
@@ -1289,17 +1355,36 @@ func (v *View) DisplayView() {
 				}
 			}
 
-			// Write the extra space
-			screen.SetContent(screenX+divider, yOffset+visualLineN, ' ', nil, lineNumStyle)
+			// Write the extra space, or the git change marker
+			marker, markerStyle := v.Buf.gitMarker(realLineN, lineNumStyle)
+			if marker == 0 || (softwrapped && visualLineN != 0) {
+				marker, markerStyle = ' ', lineNumStyle
+			}
+			screen.SetContent(screenX+divider, yOffset+visualLineN, marker, nil, markerStyle)
+			screenX++
+		} else if hasGitMarkers {
+			marker, markerStyle := v.Buf.gitMarker(realLineN, defStyle)
+			if marker == 0 || (softwrapped && visualLineN != 0) {
+				marker, markerStyle = ' ', defStyle
+			}
+			screen.SetContent(screenX+divider, yOffset+visualLineN, marker, nil, markerStyle)
 			screenX++
 		}
 
+		// Background of the sections of a merge conflict, or of the changes of a diff
+		lineBg, hasBg := v.lineBackground(realLineN)
+
 		// Cursor
 		var lastChar *Char
 		cursorSet := false
 		for _, char := range line {
 			if char != nil {
 				lineStyle := char.style
+				if hasBg && v.diff != nil {
+					lineStyle = lineStyle.Background(v.diff.charBackground(char.realLoc, lineBg))
+				} else if hasBg {
+					lineStyle = lineStyle.Background(lineBg)
+				}
 
 				charLoc := char.realLoc
 				for _, c := range v.Buf.cursors {
@@ -1400,6 +1485,12 @@ func (v *View) DisplayView() {
 					screen.SetContent(i, yOffset+visualLineN, ' ', nil, style)
 				}
 			}
+		} else if hasBg && ActiveView {
+			for i := lastX; i < xOffset+v.Width-v.lineNumOffset; i++ {
+				if !(i == cx && yOffset+visualLineN == cy) {
+					screen.SetContent(i, yOffset+visualLineN, ' ', nil, defStyle.Background(lineBg))
+				}
+			}
 		}
 
 		// Fill trailing space with inactive background